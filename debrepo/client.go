@@ -2,8 +2,20 @@ package debrepo
 
 import (
 	"bytes"
+	"crypto"
+	_ "crypto/md5" // register hash functions used by crypto.Hash.New
+	_ "crypto/sha1"
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+	"encoding/hex"
+	"io"
 	"io/ioutil"
+	"math/rand"
 	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
 
 	"github.com/pkg/errors"
 	"golang.org/x/crypto/openpgp"
@@ -23,40 +35,489 @@ type KeyRing interface {
 // Debian style archive repositories.
 //
 // KeyRing must not be nil. It is used to verify the authenticity of files on
-// the repository.
+// the repository. Repositories with a signed-by restriction are only trusted
+// with the keys it allows. See Repository.SignedByKeyRing.
 //
 // Architecture must be set to a supported architecture. See ListArchitectures
 // and ValidateArchitecture.
 //
 // If HTTPClient is nil, http.DefaultClient is used.
+//
+// Freshness controls how old a Release file may be before it is rejected. The
+// zero value rejects expired Release files. See FreshnessPolicy.
+//
+// SignaturePolicy controls which signatures on Release files are accepted. If
+// its Now is nil, the clock of Freshness is used to check key expiry.
+//
+// Files are verified using their strongest SHA256 or SHA512 checksum. MD5 and
+// SHA1 checksums are only used if AllowWeakHashes is true.
+//
+// If ReleaseState is not nil, the Date of each accepted Release file is
+// recorded and Release files older than the last one accepted for the same
+// distribution are rejected with ErrReleaseRollback.
 type Client struct {
 	HTTPClient      *http.Client
 	KeyRing         KeyRing
 	Architecture    string
+	Freshness       FreshnessPolicy
+	SignaturePolicy SignaturePolicy
+	AllowWeakHashes bool
+	ReleaseState    ReleaseStateStore
 	testhookGetFile func(context.Context, string) ([]byte, error)
 }
 
 // GetReleaseIndex returns the contents of the Release file corresponding to
 // the distribution in repo. It returns an error if the Release file
-// fails the OpenPGP signature check.
+// fails the OpenPGP signature check, the client's freshness policy or the
+// rollback check.
 func (c *Client) GetReleaseIndex(ctx context.Context, repo *Repository) ([]byte, error) {
+	release, _, err := c.GetVerifiedReleaseIndex(ctx, repo)
+	return release, err
+}
+
+// GetVerifiedReleaseIndex is like GetReleaseIndex but also returns the result
+// of verifying every signature on the Release file. Signatures are checked
+// against the client's KeyRing restricted by repo's signed-by option, as for
+// Release.CheckRepositorySignature.
+func (c *Client) GetVerifiedReleaseIndex(ctx context.Context, repo *Repository) ([]byte, *VerificationResult, error) {
 	if err := c.validate(); err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	if repo == nil || repo.isZero() {
-		return nil, errors.New("empty repo provided")
+		return nil, nil, errors.New("empty repo provided")
 	}
-	release, err := c.getReleaseFromInRelease(ctx, repo.InReleaseURL())
-	if err == nil {
-		return release, nil
+	keyring, err := repo.SignedByKeyRing(c.KeyRing.KeyRing())
+	if err != nil {
+		return nil, nil, err
+	}
+	release, result, err := c.getReleaseFromInRelease(ctx, keyring, repo.InReleaseURL())
+	if err != nil {
+		release, result, err = c.getReleaseFromFilePair(ctx, keyring, repo.ReleaseURL(), repo.ReleaseGPGURL())
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	if err := (&Release{Plaintext: release}).CheckFreshness(c.Freshness); err != nil {
+		return nil, nil, err
 	}
-	return c.getReleaseFromFilePair(ctx, repo.ReleaseURL(), repo.ReleaseGPGURL())
+	if c.ReleaseState != nil {
+		if err := checkRollback(c.ReleaseState, repo, release); err != nil {
+			return nil, nil, err
+		}
+	}
+	return release, result, nil
 }
 
 // GetPackageIndexes returns Files which can be used to read the contents of the
-// specified package indexes.
+// package indexes for each component of repo matching the client's
+// architecture. Flat repositories have a single package index. The files are
+// located using the file table in release. When the Release file lists
+// compressed variants of an index the best supported compression is selected,
+// preferring xz, then gzip, then the uncompressed file. Reads from the
+// returned Files are decompressed transparently. If the Release file sets
+// "Acquire-By-Hash: yes" the files are downloaded from the repository's
+// by-hash directories.
+//
+// An error is returned for deb-src repositories. See GetSourceIndexes.
 func (c *Client) GetPackageIndexes(ctx context.Context, repo *Repository, release *Release) ([]*File, error) {
-	panic("Not Implemented")
+	if repo != nil && repo.IsSource() {
+		return nil, errors.New("deb-src repository has no package indexes")
+	}
+	return c.getIndexFiles(repo, release, componentIndexPaths(repo, "Packages", func(component string) string {
+		return path.Join(component, "binary-"+c.Architecture, "Packages")
+	}))
+}
+
+// GetSourceIndexes returns Files which can be used to read the contents of the
+// Sources index for each component of repo. repo must be a deb-src
+// repository. The files are selected and verified as described for
+// GetPackageIndexes. See NewSourceReader.
+func (c *Client) GetSourceIndexes(ctx context.Context, repo *Repository, release *Release) ([]*File, error) {
+	if repo != nil && !repo.isZero() && !repo.IsSource() {
+		return nil, errors.New("source indexes requested for non deb-src repository")
+	}
+	return c.getIndexFiles(repo, release, componentIndexPaths(repo, "Sources", func(component string) string {
+		return path.Join(component, "source", "Sources")
+	}))
+}
+
+// GetContentsIndexes returns Files which can be used to read the contents of
+// the Contents indexes of repo matching the client's architecture, followed
+// by the Contents-all indexes of architecture independent packages if the
+// Release file lists them. Contents indexes are found in each component
+// directory or, in older repositories, directly in the distribution
+// directory. The files are selected and verified as described for
+// GetPackageIndexes. See NewContentsReader.
+func (c *Client) GetContentsIndexes(ctx context.Context, repo *Repository, release *Release) ([]*File, error) {
+	return c.getIndexFiles(repo, release, func(fileTable map[string]FileMeta) ([]string, error) {
+		listed := func(dir string) []string {
+			var indexPaths []string
+			for _, arch := range []string{c.Architecture, "all"} {
+				indexPath := path.Join(dir, "Contents-"+arch)
+				if _, err := selectIndexFile(fileTable, indexPath); err == nil {
+					indexPaths = append(indexPaths, indexPath)
+				}
+			}
+			return indexPaths
+		}
+		var indexPaths []string
+		for _, component := range repo.components {
+			indexPaths = append(indexPaths, listed(component)...)
+		}
+		if len(indexPaths) == 0 {
+			// Older repositories list a single Contents index per
+			// architecture in the distribution directory.
+			indexPaths = listed("")
+		}
+		if len(indexPaths) == 0 {
+			return nil, errors.Errorf("no Contents index listed in Release file for architecture %s", c.Architecture)
+		}
+		return indexPaths, nil
+	})
+}
+
+// FindFile returns the entries of the Contents indexes of repo whose path
+// matches pattern, listing the packages and sections which ship them, as
+// "apt-file search" does. The Release file of repo is retrieved and verified
+// as described for GetReleaseIndex and the Contents indexes are located as
+// described for GetContentsIndexes. Indexes are streamed and only matching
+// entries are kept in memory. An error is returned if an index does not
+// match its checksum.
+func (c *Client) FindFile(ctx context.Context, repo *Repository, pattern FilePattern) ([]*ContentsEntry, error) {
+	if pattern == nil {
+		return nil, errors.New("nil pattern provided")
+	}
+	b, err := c.GetReleaseIndex(ctx, repo)
+	if err != nil {
+		return nil, err
+	}
+	files, err := c.GetContentsIndexes(ctx, repo, &Release{Plaintext: b})
+	if err != nil {
+		return nil, err
+	}
+	var entries []*ContentsEntry
+	for _, file := range files {
+		matches, err := c.searchContents(ctx, file, pattern)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, matches...)
+	}
+	return entries, nil
+}
+
+// searchContents returns the entries of the Contents index file matching
+// pattern.
+func (c *Client) searchContents(ctx context.Context, file *File, pattern FilePattern) ([]*ContentsEntry, error) {
+	r, err := file.Open(ctx, c.HTTPClient)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	var entries []*ContentsEntry
+	cr := NewContentsReader(r)
+	for {
+		entry, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, file.URL())
+		}
+		if pattern.MatchPath(entry.Path) {
+			entries = append(entries, entry)
+		}
+	}
+	// Read any data following the last entry so it is included in the hash.
+	if _, err := io.Copy(ioutil.Discard, r); err != nil {
+		return nil, err
+	}
+	if err := file.CheckHash(); err != nil {
+		return nil, errors.Wrap(err, file.URL())
+	}
+	return entries, nil
+}
+
+// componentIndexPaths returns a function listing the index of each component
+// of repo, whose path is returned by componentPath, or flatPath for flat
+// repositories.
+func componentIndexPaths(repo *Repository, flatPath string, componentPath func(string) string) func(map[string]FileMeta) ([]string, error) {
+	return func(map[string]FileMeta) ([]string, error) {
+		var indexPaths []string
+		if repo.IsFlat() {
+			indexPaths = []string{flatPath}
+		}
+		for _, component := range repo.components {
+			indexPaths = append(indexPaths, componentPath(component))
+		}
+		return indexPaths, nil
+	}
+}
+
+// getIndexFiles returns Files for the indexes of repo whose paths are returned
+// by indexPaths.
+func (c *Client) getIndexFiles(repo *Repository, release *Release, indexPaths func(map[string]FileMeta) ([]string, error)) ([]*File, error) {
+	if err := c.validate(); err != nil {
+		return nil, err
+	}
+	if repo == nil || repo.isZero() {
+		return nil, errors.New("empty repo provided")
+	}
+	if release == nil {
+		return nil, errors.New("nil release provided")
+	}
+	fileTable, err := release.ReadFileTable()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read Release file table")
+	}
+	info, err := release.ReadInfo()
+	if err != nil {
+		return nil, err
+	}
+	paths, err := indexPaths(fileTable)
+	if err != nil {
+		return nil, err
+	}
+	files := make([]*File, 0, len(paths))
+	for _, indexPath := range paths {
+		file, err := selectIndexFile(fileTable, indexPath)
+		if err != nil {
+			return nil, err
+		}
+		file.allowWeakHash = c.AllowWeakHashes
+		if info.AcquireByHash {
+			if h, sum, ok := file.meta.StrongestHash(c.AllowWeakHashes); ok {
+				file.byHashURL = repo.distURL(byHashPath(file.url, h, sum))
+			}
+		}
+		file.url = repo.distURL(file.url)
+		files = append(files, file)
+	}
+	return files, nil
+}
+
+// DownloadPackage downloads the .deb file for pkg from repo and writes it to
+// w. The package must list its Size. The number of bytes read must match it
+// and the contents must match the strongest checksum listed (SHA512 or
+// SHA256, then SHA1 or MD5 if the client allows weak hashes). A *SizeError or
+// *ChecksumError is returned on mismatch. Because the contents are streamed, w
+// may have received data before the mismatch was detected; it must be
+// discarded if an error is returned. See DownloadPackageFile.
+func (c *Client) DownloadPackage(ctx context.Context, repo *Repository, pkg *Package, w io.Writer) error {
+	if err := c.validate(); err != nil {
+		return err
+	}
+	if repo == nil || repo.isZero() {
+		return errors.New("empty repo provided")
+	}
+	if pkg == nil || len(pkg.Filename) == 0 {
+		return errors.New("package has no Filename")
+	}
+	if pkg.Size <= 0 {
+		return errors.Errorf("package %s has no Size", pkg.Package)
+	}
+	var hashType crypto.Hash
+	var expected []byte
+	switch {
+	case len(pkg.SHA512) > 0:
+		hashType, expected = crypto.SHA512, pkg.SHA512
+	case len(pkg.SHA256) > 0:
+		hashType, expected = crypto.SHA256, pkg.SHA256
+	case c.AllowWeakHashes && len(pkg.SHA1) > 0:
+		hashType, expected = crypto.SHA1, pkg.SHA1
+	case c.AllowWeakHashes && len(pkg.MD5Sum) > 0:
+		hashType, expected = crypto.MD5, pkg.MD5Sum
+	default:
+		return errors.Errorf("package %s has no SHA256 or SHA512 checksum", pkg.Package)
+	}
+	return c.download(ctx, repo.fileURL(pkg.Filename), pkg.Size, hashType, expected, w)
+}
+
+// DownloadPackageFile downloads the .deb file for pkg from repo and saves it
+// to filename. The contents are written to a temporary file in the same
+// directory which is renamed to filename only after it has been verified. See
+// DownloadPackage.
+func (c *Client) DownloadPackageFile(ctx context.Context, repo *Repository, pkg *Package, filename string) error {
+	return writeFileAtomic(filename, func(w io.Writer) error {
+		return c.DownloadPackage(ctx, repo, pkg, w)
+	})
+}
+
+// DownloadSource downloads the source package src from repo into dir, as
+// "apt-get source --download-only" does, and returns the path of its .dsc
+// file. The .dsc file is downloaded first from src.Directory, followed by
+// every file listed in its Files field, such as the orig tarballs and the
+// debian tarball or diff. Each file must be listed in the Sources index entry
+// and is verified against its strongest checksum there (SHA512 or SHA256,
+// then SHA1 or MD5 if the client allows weak hashes).
+//
+// If keyring is not nil the .dsc file must be clearsigned by a key in
+// keyring. Source packages are usually signed by their uploader rather than
+// the archive, so keyring is separate from the client's KeyRing.
+//
+// Files are written to dir only after they have been verified. Files written
+// by a failed download are removed.
+func (c *Client) DownloadSource(ctx context.Context, repo *Repository, src *SourcePackage, dir string, keyring openpgp.KeyRing) (dscPath string, err error) {
+	if err := c.validate(); err != nil {
+		return "", err
+	}
+	if repo == nil || repo.isZero() {
+		return "", errors.New("empty repo provided")
+	}
+	if src == nil || len(src.Directory) == 0 {
+		return "", errors.New("source package has no Directory")
+	}
+	hashType, table, err := src.strongestChecksums(c.AllowWeakHashes)
+	if err != nil {
+		return "", err
+	}
+	dsc, err := src.dscFile(table)
+	if err != nil {
+		return "", err
+	}
+	buf := &bytes.Buffer{}
+	if err := c.download(ctx, repo.fileURL(path.Join(src.Directory, dsc.Name)), dsc.Size, hashType, dsc.HashSum, buf); err != nil {
+		return "", err
+	}
+	// The signers allowed by the client's policy are archive keys, so only
+	// its hash restrictions apply to .dsc files.
+	policy := SignaturePolicy{RejectHashes: c.SignaturePolicy.RejectHashes, Now: c.signaturePolicy().Now}
+	dscInfo, err := readDsc(buf.Bytes(), keyring, policy)
+	if err != nil {
+		return "", errors.Wrapf(err, "source package %s: %s", src.Package, dsc.Name)
+	}
+	files := []SourceFile{dsc}
+	for _, listed := range dscInfo.Files {
+		f, ok := findSourceFile(table, listed.Name)
+		if !ok {
+			return "", errors.Errorf("source package %s: file %s not listed in Sources index", src.Package, listed.Name)
+		}
+		files = append(files, f)
+	}
+
+	var written []string
+	defer func() {
+		if err != nil {
+			for _, filename := range written {
+				os.Remove(filename)
+			}
+		}
+	}()
+	dscPath = filepath.Join(dir, dsc.Name)
+	if err = writeFileAtomic(dscPath, func(w io.Writer) error {
+		_, err := w.Write(buf.Bytes())
+		return err
+	}); err != nil {
+		return "", err
+	}
+	written = append(written, dscPath)
+	for _, f := range files[1:] {
+		url := repo.fileURL(path.Join(src.Directory, f.Name))
+		filename := filepath.Join(dir, f.Name)
+		if err = writeFileAtomic(filename, func(w io.Writer) error {
+			return c.download(ctx, url, f.Size, hashType, f.HashSum, w)
+		}); err != nil {
+			return "", err
+		}
+		written = append(written, filename)
+	}
+	return dscPath, nil
+}
+
+// download streams the file at url to w. The number of bytes read must match
+// size and the contents must match the checksum expected. A *SizeError or
+// *ChecksumError is returned on mismatch.
+func (c *Client) download(ctx context.Context, url string, size int64, hashType crypto.Hash, expected []byte, w io.Writer) error {
+	resp, err := ctxhttp.Get(ctx, c.HTTPClient, url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return errors.Errorf("failed to get remote file: %s: %s", url, resp.Status)
+	}
+	h := hashType.New()
+	// Read one byte past the expected size to detect oversized responses.
+	r := io.LimitReader(resp.Body, size+1)
+	n, err := io.Copy(io.MultiWriter(w, h), r)
+	if err != nil {
+		return err
+	}
+	if n != size {
+		return &SizeError{URL: url, Expected: size, Actual: n}
+	}
+	if actual := h.Sum(nil); !bytes.Equal(actual, expected) {
+		return &ChecksumError{URL: url, Hash: hashType, Expected: expected, Actual: actual}
+	}
+	return nil
+}
+
+// writeFileAtomic calls write with a temporary file in the same directory as
+// filename. The temporary file is renamed to filename if write succeeds and
+// removed otherwise. The file is created with mode 0644, less the umask.
+func writeFileAtomic(filename string, write func(io.Writer) error) (err error) {
+	f, err := createTempFile(filename)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			f.Close()
+			os.Remove(f.Name())
+		}
+	}()
+	if err = write(f); err != nil {
+		return err
+	}
+	if err = f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), filename)
+}
+
+// createTempFile creates a new file with mode 0644, less the umask, in the
+// same directory as filename. Unlike ioutil.TempFile, which always uses mode
+// 0600, the file keeps the mode of a file created normally once renamed.
+func createTempFile(filename string) (*os.File, error) {
+	dir, base := filepath.Split(filename)
+	for i := 0; i < 10000; i++ {
+		name := filepath.Join(dir, "."+base+"."+strconv.FormatUint(uint64(rand.Uint32()), 10))
+		f, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0644)
+		if os.IsExist(err) {
+			continue
+		}
+		return f, err
+	}
+	return nil, errors.Errorf("failed to create temporary file for %s", filename)
+}
+
+// selectIndexFile returns a File for the best compressed variant of the index
+// at indexPath listed in fileTable. The url of the returned File is set to the
+// path of the selected variant relative to the distribution directory.
+func selectIndexFile(fileTable map[string]FileMeta, indexPath string) (*File, error) {
+	for _, comp := range compressions {
+		name := indexPath + comp.ext()
+		if meta, ok := fileTable[name]; ok {
+			return &File{meta: meta, url: name, compression: comp}, nil
+		}
+	}
+	return nil, errors.Errorf("index not listed in Release file: %s", indexPath)
+}
+
+// byHashPath returns the path of the by-hash copy of the file at filepath
+// with checksum sum, as used by repositories supporting Acquire-By-Hash.
+func byHashPath(filepath string, h crypto.Hash, sum []byte) string {
+	return path.Join(path.Dir(filepath), "by-hash", hashName(h), hex.EncodeToString(sum))
+}
+
+// signaturePolicy returns the client's SignaturePolicy, using the clock of
+// its FreshnessPolicy if the SignaturePolicy has none.
+func (c *Client) signaturePolicy() SignaturePolicy {
+	policy := c.SignaturePolicy
+	if policy.Now == nil {
+		policy.Now = c.Freshness.Now
+	}
+	return policy
 }
 
 func (c *Client) validate() error {
@@ -81,37 +542,38 @@ func (c *Client) getFile(ctx context.Context, url string) ([]byte, error) {
 	return ioutil.ReadAll(resp.Body)
 }
 
-func (c *Client) getReleaseFromInRelease(ctx context.Context, inReleaseURL string) ([]byte, error) {
+func (c *Client) getReleaseFromInRelease(ctx context.Context, keyring openpgp.KeyRing, inReleaseURL string) ([]byte, *VerificationResult, error) {
 	b, err := c.getFile(ctx, inReleaseURL)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	block, _ := clearsign.Decode(b)
-	bb := bytes.NewBuffer(block.Bytes)
-	if _, err := openpgp.CheckDetachedSignature(c.KeyRing.KeyRing(), bb, block.ArmoredSignature.Body); err != nil {
-		return nil, errors.Wrap(err, "InRelease file failed signature check")
+	if block == nil {
+		return nil, nil, errors.New("InRelease file is not clearsigned")
+	}
+	result, err := verifySignatures(keyring, block.Bytes, block.ArmoredSignature.Body, c.signaturePolicy())
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "InRelease file failed signature check")
 	}
-	return block.Plaintext, nil
+	return block.Plaintext, result, nil
 }
 
-func (c *Client) getReleaseFromFilePair(ctx context.Context, releaseURL, releaseGPGURL string) ([]byte, error) {
-	b, err := c.getFile(ctx, releaseURL)
+func (c *Client) getReleaseFromFilePair(ctx context.Context, keyring openpgp.KeyRing, releaseURL, releaseGPGURL string) ([]byte, *VerificationResult, error) {
+	release, err := c.getFile(ctx, releaseURL)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
-	block := &clearsign.Block{Plaintext: b}
-
-	b, err = c.getFile(ctx, releaseGPGURL)
+	b, err := c.getFile(ctx, releaseGPGURL)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
-	block.ArmoredSignature, err = armor.Decode(bytes.NewBuffer(b))
+	signature, err := armor.Decode(bytes.NewBuffer(b))
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
-	bb := bytes.NewBuffer(block.Plaintext)
-	if _, err := openpgp.CheckDetachedSignature(c.KeyRing.KeyRing(), bb, block.ArmoredSignature.Body); err != nil {
-		return nil, errors.Wrap(err, "Release file failed signature check")
+	result, err := verifySignatures(keyring, release, signature.Body, c.signaturePolicy())
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "Release file failed signature check")
 	}
-	return block.Plaintext, nil
+	return release, result, nil
 }
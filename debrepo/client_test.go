@@ -2,11 +2,20 @@ package debrepo
 
 import (
 	"bytes"
+	"crypto/sha256"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path"
+	"path/filepath"
 	"reflect"
+	"sort"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/pkg/errors"
 
@@ -71,6 +80,86 @@ func TestClientGetReleaseIndex_ReleaseAndReleaseGPGPresent_ReturnsRelease(t *tes
 	}
 }
 
+func TestClientGetReleaseIndex_StaleRelease_ReturnsError(t *testing.T) {
+	now := time.Date(2016, time.October, 10, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		release   string
+		freshness FreshnessPolicy
+		err       error
+	}{
+		{
+			release: "Date: Sat, 01 Oct 2016 00:00:00 UTC\nValid-Until: Sat, 08 Oct 2016 00:00:00 UTC\n",
+			err:     ErrReleaseExpired,
+		},
+		{
+			release:   "Date: Sat, 01 Oct 2016 00:00:00 UTC\n",
+			freshness: FreshnessPolicy{MaxAge: 7 * 24 * time.Hour},
+			err:       ErrReleaseTooOld,
+		},
+		{
+			release: "Date: Mon, 10 Oct 2016 00:01:00 UTC\n",
+			err:     ErrReleaseInFuture,
+		},
+		{
+			release:   "Date: Mon, 10 Oct 2016 00:01:00 UTC\n",
+			freshness: FreshnessPolicy{ClockSkew: time.Hour},
+			err:       nil,
+		},
+		{
+			release:   "Date: Sat, 01 Oct 2016 00:00:00 UTC\nValid-Until: Sat, 15 Oct 2016 00:00:00 UTC\n",
+			freshness: FreshnessPolicy{MaxAge: 30 * 24 * time.Hour},
+			err:       nil,
+		},
+	}
+	for i, test := range tests {
+		inRelease, _, _, keyRing := newTestKeyRingAndSignedRelease([]byte(test.release))
+		client := &Client{KeyRing: keyRing, Architecture: "amd64", Freshness: test.freshness}
+		client.Freshness.Now = func() time.Time { return now }
+		client.testhookGetFile = func(ctx context.Context, url string) ([]byte, error) {
+			return inRelease, nil
+		}
+		repo, _ := ParseRepository("deb http://example.com/ubuntu xenial main")
+		_, err := client.GetReleaseIndex(context.Background(), repo)
+		if expected, actual := test.err, errors.Cause(err); expected != actual {
+			t.Fatalf("test(%v): expected=%v actual=%v", i, expected, err)
+		}
+	}
+}
+
+func TestClientGetReleaseIndex_OlderRelease_ReturnsRollbackError(t *testing.T) {
+	tests := []struct {
+		release string
+		err     error
+	}{
+		{release: "Date: Sat, 01 Oct 2016 00:00:00 UTC\n", err: nil},
+		{release: "Date: Mon, 03 Oct 2016 00:00:00 UTC\n", err: nil},
+		{release: "Date: Mon, 03 Oct 2016 00:00:00 UTC\n", err: nil},
+		{release: "Date: Sun, 02 Oct 2016 00:00:00 UTC\n", err: ErrReleaseRollback},
+		{release: "Date: Tue, 04 Oct 2016 00:00:00 UTC\n", err: nil},
+	}
+	store := NewMemoryReleaseStateStore()
+	repo, _ := ParseRepository("deb http://example.com/ubuntu xenial main")
+	for i, test := range tests {
+		inRelease, _, _, keyRing := newTestKeyRingAndSignedRelease([]byte(test.release))
+		client := &Client{KeyRing: keyRing, Architecture: "amd64", ReleaseState: store}
+		client.testhookGetFile = func(ctx context.Context, url string) ([]byte, error) {
+			return inRelease, nil
+		}
+		_, err := client.GetReleaseIndex(context.Background(), repo)
+		if expected, actual := test.err, errors.Cause(err); expected != actual {
+			t.Fatalf("test(%v): expected=%v actual=%v", i, expected, err)
+		}
+	}
+	state, err := store.Get(repo.stateKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := time.Date(2016, time.October, 4, 0, 0, 0, 0, time.UTC)
+	if state == nil || !state.Date.Equal(expected) {
+		t.Fatalf("expected=%v actual=%v", expected, state)
+	}
+}
+
 func TestClientValidate_ValidClient_NoError(t *testing.T) {
 	client := newTestValidClient()
 	if err := client.validate(); err != nil {
@@ -129,7 +218,7 @@ func TestClientGetReleaseFromInRelease_PresentAndValidSignature_NoError(t *testi
 	inRelease, release, _, keyRing := newTestKeyRingAndRelease()
 	client := &Client{KeyRing: keyRing}
 	client.testhookGetFile = getFileInRelease(t, inRelease)
-	actual, err := client.getReleaseFromInRelease(context.Background(), "InRelease")
+	actual, _, err := client.getReleaseFromInRelease(context.Background(), client.KeyRing.KeyRing(), "InRelease")
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -142,7 +231,7 @@ func TestClientGetReleaseFromInRelease_PresentButInvalidSignature_ReturnsError(t
 	inRelease, _, _, _ := newTestKeyRingAndRelease()
 	client := &Client{KeyRing: newTestKeyRingEmpty()}
 	client.testhookGetFile = getFileInRelease(t, inRelease)
-	_, err := client.getReleaseFromInRelease(context.Background(), "InRelease")
+	_, _, err := client.getReleaseFromInRelease(context.Background(), client.KeyRing.KeyRing(), "InRelease")
 	if err == nil {
 		t.Fatal("expected error on signature failure")
 	}
@@ -152,7 +241,7 @@ func TestClientGetReleaseFromFilePair_BothPresentAndValidSignature_NoError(t *te
 	_, release, releaseGPG, keyRing := newTestKeyRingAndRelease()
 	client := &Client{KeyRing: keyRing}
 	client.testhookGetFile = getFileByFilePair(t, release, releaseGPG)
-	actual, err := client.getReleaseFromFilePair(context.Background(), "Release", "Release.gpg")
+	actual, _, err := client.getReleaseFromFilePair(context.Background(), client.KeyRing.KeyRing(), "Release", "Release.gpg")
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -165,11 +254,526 @@ func TestClientGetReleaseFromFilePair_InvalidSignature_ReturnsError(t *testing.T
 	_, release, releaseGPG, _ := newTestKeyRingAndRelease()
 	client := &Client{KeyRing: newTestKeyRingEmpty()}
 	client.testhookGetFile = getFileByFilePair(t, release, releaseGPG)
-	if _, err := client.getReleaseFromFilePair(context.Background(), "Release", "Release.gpg"); err == nil {
+	if _, _, err := client.getReleaseFromFilePair(context.Background(), client.KeyRing.KeyRing(), "Release", "Release.gpg"); err == nil {
 		t.Fatal("expected error on signature failure")
 	}
 }
 
+func TestClientGetPackageIndexes_TestRepository_ReturnsDecompressingFiles(t *testing.T) {
+	tr := NewTestRepository()
+	defer tr.Close()
+	release, err := GetRelease(context.Background(), nil, tr.Repository())
+	if err != nil {
+		t.Fatalf("unexpected error getting release: %v", err)
+	}
+	client := &Client{KeyRing: &testKeyRing{tr.KeyRing()}, Architecture: "amd64"}
+	files, err := client.GetPackageIndexes(context.Background(), tr.Repository(), release)
+	if err != nil {
+		t.Fatalf("unexpected error getting package indexes: %v", err)
+	}
+	if expected, actual := 1, len(files); expected != actual {
+		t.Fatalf("number of files: expected=%v actual=%v", expected, actual)
+	}
+	file := files[0]
+	if expected, actual := tr.URL+"/ubuntu/dists/xenial/main/binary-amd64/Packages.xz", file.URL(); expected != actual {
+		t.Fatalf("url: expected=%v actual=%v", expected, actual)
+	}
+	r, err := file.Open(context.Background(), nil)
+	if err != nil {
+		t.Fatalf("unexpected error opening file: %v", err)
+	}
+	defer file.Close()
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatalf("unexpected error reading file: %v", err)
+	}
+	if expected, actual := int64(7228243), int64(len(b)); expected != actual {
+		t.Fatalf("decompressed size: expected=%v actual=%v", expected, actual)
+	}
+	if err := file.CheckHash(); err != nil {
+		t.Fatalf("unexpected hash failure: %v", err)
+	}
+}
+
+func TestClientGetPackageIndexes_AcquireByHash_FetchesByHashWithFallback(t *testing.T) {
+	const byHash = "/ubuntu/dists/xenial/main/binary-amd64/by-hash/SHA256/76858a337b1665561a256cea6f7ef32515517754e3c5e54c1895cf29e1b41884"
+	const canonical = "/ubuntu/dists/xenial/main/binary-amd64/Packages.xz"
+	tests := []struct {
+		block    string
+		requests []string
+	}{
+		{"", []string{byHash}},
+		{path.Base(byHash), []string{byHash, canonical}},
+	}
+	for i, test := range tests {
+		tr := NewTestRepository()
+		release, err := GetRelease(context.Background(), nil, tr.Repository())
+		if err != nil {
+			t.Fatalf("test(%v): unexpected error getting release: %v", i, err)
+		}
+		client := &Client{KeyRing: &testKeyRing{tr.KeyRing()}, Architecture: "amd64"}
+		files, err := client.GetPackageIndexes(context.Background(), tr.Repository(), release)
+		if err != nil {
+			t.Fatalf("test(%v): unexpected error getting package indexes: %v", i, err)
+		}
+		tr.BlockFile(test.block)
+		start := len(tr.Requests())
+		r, err := files[0].Open(context.Background(), nil)
+		if err != nil {
+			t.Fatalf("test(%v): unexpected error opening file: %v", i, err)
+		}
+		io.Copy(ioutil.Discard, r)
+		files[0].Close()
+		if err := files[0].CheckHash(); err != nil {
+			t.Fatalf("test(%v): unexpected hash failure: %v", i, err)
+		}
+		if expected, actual := test.requests, tr.Requests()[start:]; !reflect.DeepEqual(expected, actual) {
+			t.Fatalf("test(%v): expected=%v actual=%v", i, expected, actual)
+		}
+		tr.Close()
+	}
+}
+
+func TestClientGetPackageIndexes_MissingComponent_ReturnsError(t *testing.T) {
+	tr := NewTestRepository()
+	defer tr.Close()
+	release, _ := GetRelease(context.Background(), nil, tr.Repository())
+	repo, _ := ParseRepository("deb " + tr.URL + "/ubuntu xenial missing")
+	client := &Client{KeyRing: &testKeyRing{tr.KeyRing()}, Architecture: "amd64"}
+	if _, err := client.GetPackageIndexes(context.Background(), repo, release); err == nil {
+		t.Fatal("expected error when component is not listed in Release file")
+	}
+}
+
+func TestClientGetPackageIndexes_FlatRepository_ReturnsSingleIndex(t *testing.T) {
+	release := &Release{Plaintext: []byte(`Origin: Example
+MD5Sum:
+ 8d777f385d3dfec8815d20f7496026dc 4 Packages.gz
+SHA1:
+ a17c9aaa61e80a1bf71d0d850af4e5baa9800bbd 4 Packages.gz
+SHA256:
+ 87428fc522803d31065e7bce3cf03fe475096631e5e07bbd7a0fde60c4cf25c7 4 Packages.gz
+`)}
+	repo, _ := ParseRepository("deb http://example.com/debian ./")
+	client := newTestValidClient()
+	files, err := client.GetPackageIndexes(context.Background(), repo, release)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if expected, actual := 1, len(files); expected != actual {
+		t.Fatalf("number of files: expected=%v actual=%v", expected, actual)
+	}
+	if expected, actual := "http://example.com/debian/Packages.gz", files[0].URL(); expected != actual {
+		t.Fatalf("url: expected=%v actual=%v", expected, actual)
+	}
+}
+
+func TestClientGetSourceIndexes_SourceRepository_ReturnsSourcesIndexes(t *testing.T) {
+	release := &Release{Plaintext: []byte(`Origin: Example
+SHA256:
+ 87428fc522803d31065e7bce3cf03fe475096631e5e07bbd7a0fde60c4cf25c7 4 main/source/Sources.gz
+ 87428fc522803d31065e7bce3cf03fe475096631e5e07bbd7a0fde60c4cf25c7 4 contrib/source/Sources
+ 87428fc522803d31065e7bce3cf03fe475096631e5e07bbd7a0fde60c4cf25c7 4 main/binary-amd64/Packages.gz
+`)}
+	repo, _ := ParseRepository("deb-src http://example.com/debian xenial main contrib")
+	client := newTestValidClient()
+	files, err := client.GetSourceIndexes(context.Background(), repo, release)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := []string{
+		"http://example.com/debian/dists/xenial/main/source/Sources.gz",
+		"http://example.com/debian/dists/xenial/contrib/source/Sources",
+	}
+	var actual []string
+	for _, file := range files {
+		actual = append(actual, file.URL())
+	}
+	if !reflect.DeepEqual(expected, actual) {
+		t.Fatalf("expected=%v actual=%v", expected, actual)
+	}
+	if _, err := client.GetPackageIndexes(context.Background(), repo, release); err == nil {
+		t.Fatal("expected error getting package indexes of deb-src repository")
+	}
+	repo, _ = ParseRepository("deb http://example.com/debian xenial main")
+	if _, err := client.GetSourceIndexes(context.Background(), repo, release); err == nil {
+		t.Fatal("expected error getting source indexes of deb repository")
+	}
+}
+
+func TestClientGetContentsIndexes_TestRepository_ReturnsDistributionIndex(t *testing.T) {
+	tr := NewTestRepository()
+	defer tr.Close()
+	release, _ := GetRelease(context.Background(), nil, tr.Repository())
+	client := &Client{KeyRing: &testKeyRing{tr.KeyRing()}, Architecture: "amd64"}
+	files, err := client.GetContentsIndexes(context.Background(), tr.Repository(), release)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if expected, actual := 1, len(files); expected != actual {
+		t.Fatalf("number of files: expected=%v actual=%v", expected, actual)
+	}
+	if expected, actual := tr.URL+"/ubuntu/dists/xenial/Contents-amd64.gz", files[0].URL(); expected != actual {
+		t.Fatalf("url: expected=%v actual=%v", expected, actual)
+	}
+}
+
+func TestClientFindFile(t *testing.T) {
+	contents := map[string][]byte{
+		"main/Contents-amd64":    []byte("usr/bin/hello    devel/hello\nusr/bin/ls    utils/coreutils\n"),
+		"main/Contents-all":      []byte("usr/share/doc/hello/README    doc/hello-doc\n"),
+		"contrib/Contents-amd64": []byte("usr/bin/hello-contrib    contrib/devel/hello-contrib\n"),
+	}
+	release := "SHA256:\n"
+	for _, name := range []string{"main/Contents-amd64", "main/Contents-all", "contrib/Contents-amd64"} {
+		release += fmt.Sprintf(" %x %d %s\n", sha256.Sum256(contents[name]), len(contents[name]), name)
+	}
+	inRelease, _, _, keyRing := newTestKeyRingAndSignedRelease([]byte(release))
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := strings.TrimPrefix(r.URL.Path, "/debian/dists/sid/")
+		if name == "InRelease" {
+			w.Write(inRelease)
+			return
+		}
+		b, ok := contents[name]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write(b)
+	}))
+	defer server.Close()
+	repo, _ := ParseRepository("deb " + server.URL + "/debian sid main contrib")
+	client := &Client{KeyRing: keyRing, Architecture: "amd64"}
+
+	glob, _ := GlobPath("*hello*")
+	entries, err := client.FindFile(context.Background(), repo, glob)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := []*ContentsEntry{
+		{"usr/bin/hello", []ContentsLocation{{"devel", "hello"}}},
+		{"usr/share/doc/hello/README", []ContentsLocation{{"doc", "hello-doc"}}},
+		{"usr/bin/hello-contrib", []ContentsLocation{{"contrib/devel", "hello-contrib"}}},
+	}
+	if actual := entries; !reflect.DeepEqual(expected, actual) {
+		t.Fatalf("expected=%v actual=%v", expected, actual)
+	}
+
+	contents["main/Contents-all"] = []byte("usr/share/doc/hello/README    doc/hello-DOC\n")
+	if _, err := client.FindFile(context.Background(), repo, ExactPath("/usr/bin/ls")); err == nil {
+		t.Fatal("expected error when Contents index does not match its checksum")
+	}
+}
+
+var selectIndexFileTests = []struct {
+	files       []string
+	url         string
+	compression compression
+	valid       bool
+}{
+	{
+		files:       []string{"main/binary-amd64/Packages", "main/binary-amd64/Packages.gz", "main/binary-amd64/Packages.xz"},
+		url:         "main/binary-amd64/Packages.xz",
+		compression: compressionXZ,
+		valid:       true,
+	},
+	{
+		files:       []string{"main/binary-amd64/Packages", "main/binary-amd64/Packages.gz"},
+		url:         "main/binary-amd64/Packages.gz",
+		compression: compressionGzip,
+		valid:       true,
+	},
+	{
+		files:       []string{"main/binary-amd64/Packages", "main/binary-amd64/Packages.bz2"},
+		url:         "main/binary-amd64/Packages",
+		compression: compressionNone,
+		valid:       true,
+	},
+	{
+		files: []string{"main/binary-i386/Packages"},
+		valid: false,
+	},
+}
+
+func TestSelectIndexFile(t *testing.T) {
+	for i, test := range selectIndexFileTests {
+		fileTable := make(map[string]FileMeta)
+		for _, name := range test.files {
+			fileTable[name] = FileMeta{}
+		}
+		file, err := selectIndexFile(fileTable, "main/binary-amd64/Packages")
+		if expected, actual := test.valid, err == nil; expected != actual {
+			t.Fatalf("test(%v): valid: expected=%v actual=%v", i, expected, actual)
+		}
+		if !test.valid {
+			continue
+		}
+		if expected, actual := test.url, file.url; expected != actual {
+			t.Fatalf("test(%v): url: expected=%v actual=%v", i, expected, actual)
+		}
+		if expected, actual := test.compression, file.compression; expected != actual {
+			t.Fatalf("test(%v): compression: expected=%v actual=%v", i, expected, actual)
+		}
+	}
+}
+
+func TestClientDownloadPackage_ValidPackage_WritesContents(t *testing.T) {
+	server, repo, pkg := newTestPackageServer(t, []byte("package contents"))
+	defer server.Close()
+	client := newTestValidClient()
+	buf := &bytes.Buffer{}
+	if err := client.DownloadPackage(context.Background(), repo, pkg, buf); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if expected, actual := "package contents", buf.String(); expected != actual {
+		t.Fatalf("expected=%v actual=%v", expected, actual)
+	}
+}
+
+func TestClientDownloadPackage_ChecksumMismatch_ReturnsChecksumError(t *testing.T) {
+	server, repo, pkg := newTestPackageServer(t, []byte("package contents"))
+	defer server.Close()
+	pkg.SHA256 = decodeHexString("0000000000000000000000000000000000000000000000000000000000000000")
+	client := newTestValidClient()
+	err := client.DownloadPackage(context.Background(), repo, pkg, ioutil.Discard)
+	if _, ok := err.(*ChecksumError); !ok {
+		t.Fatalf("expected *ChecksumError, got: %v", err)
+	}
+}
+
+func TestClientDownloadPackage_SizeMismatch_ReturnsSizeError(t *testing.T) {
+	for _, size := range []int64{1, 100} {
+		server, repo, pkg := newTestPackageServer(t, []byte("package contents"))
+		pkg.Size = size
+		client := newTestValidClient()
+		err := client.DownloadPackage(context.Background(), repo, pkg, ioutil.Discard)
+		server.Close()
+		if _, ok := err.(*SizeError); !ok {
+			t.Fatalf("size(%v): expected *SizeError, got: %v", size, err)
+		}
+	}
+}
+
+func TestClientDownloadPackage_NoSize_ReturnsError(t *testing.T) {
+	server, repo, pkg := newTestPackageServer(t, []byte("package contents"))
+	defer server.Close()
+	pkg.Size = 0
+	client := newTestValidClient()
+	err := client.DownloadPackage(context.Background(), repo, pkg, ioutil.Discard)
+	if err == nil || !strings.Contains(err.Error(), "has no Size") {
+		t.Fatalf("expected error when package has no Size, got: %v", err)
+	}
+}
+
+func TestClientDownloadPackage_NoStrongChecksum_ReturnsError(t *testing.T) {
+	server, repo, pkg := newTestPackageServer(t, []byte("package contents"))
+	defer server.Close()
+	pkg.SHA256 = nil
+	client := newTestValidClient()
+	if err := client.DownloadPackage(context.Background(), repo, pkg, ioutil.Discard); err == nil {
+		t.Fatal("expected error when package has no SHA256 or SHA512 checksum")
+	}
+}
+
+func TestClientDownloadPackageFile(t *testing.T) {
+	server, repo, pkg := newTestPackageServer(t, []byte("package contents"))
+	defer server.Close()
+	dir, err := ioutil.TempDir("", "debrepo")
+	if err != nil {
+		t.Fatalf("unexpected error creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	client := newTestValidClient()
+
+	filename := filepath.Join(dir, "foo.deb")
+	if err := client.DownloadPackageFile(context.Background(), repo, pkg, filename); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if b, _ := ioutil.ReadFile(filename); string(b) != "package contents" {
+		t.Fatalf("unexpected file contents: %s", b)
+	}
+	// The file must have the mode of a file created normally, with the umask
+	// applied.
+	reference := filepath.Join(dir, "reference")
+	if err := ioutil.WriteFile(reference, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	expectedInfo, _ := os.Stat(reference)
+	os.Remove(reference)
+	if actualInfo, err := os.Stat(filename); err != nil || expectedInfo.Mode() != actualInfo.Mode() {
+		t.Fatalf("mode: expected=%v actual=%v", expectedInfo.Mode(), actualInfo)
+	}
+
+	pkg.Size = 1
+	filename = filepath.Join(dir, "bad.deb")
+	if err := client.DownloadPackageFile(context.Background(), repo, pkg, filename); err == nil {
+		t.Fatal("expected error on size mismatch")
+	}
+	if files, _ := ioutil.ReadDir(dir); len(files) != 1 {
+		t.Fatalf("expected failed download to be removed, found %v files", len(files))
+	}
+}
+
+func TestClientDownloadSource(t *testing.T) {
+	el := testGenerateEntityList()
+	dsc := testSignDsc(t, el, "Source: hello\nVersion: 2.10-1\nFiles:\n 00 4 hello_2.10.orig.tar.gz\n 00 6 hello_2.10-1.debian.tar.xz\n")
+	files := map[string][]byte{
+		"hello_2.10-1.dsc":            dsc,
+		"hello_2.10.orig.tar.gz":      []byte("orig"),
+		"hello_2.10-1.debian.tar.xz":  []byte("debian"),
+		"hello_2.10-1.unreferenced.x": []byte("unreferenced"),
+	}
+	server, repo, src := newTestSourceServer(t, files)
+	defer server.Close()
+	dir, err := ioutil.TempDir("", "debrepo")
+	if err != nil {
+		t.Fatalf("unexpected error creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	client := newTestValidClient()
+
+	dscPath, err := client.DownloadSource(context.Background(), repo, src, dir, el)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if expected, actual := filepath.Join(dir, "hello_2.10-1.dsc"), dscPath; expected != actual {
+		t.Fatalf("dsc path: expected=%v actual=%v", expected, actual)
+	}
+	for _, name := range []string{"hello_2.10-1.dsc", "hello_2.10.orig.tar.gz", "hello_2.10-1.debian.tar.xz"} {
+		if b, _ := ioutil.ReadFile(filepath.Join(dir, name)); !bytes.Equal(files[name], b) {
+			t.Fatalf("%s: unexpected file contents: %s", name, b)
+		}
+	}
+	if infos, _ := ioutil.ReadDir(dir); len(infos) != 3 {
+		t.Fatalf("expected 3 files downloaded, found %v", len(infos))
+	}
+}
+
+func TestClientDownloadSource_InvalidSource_ReturnsErrorAndRemovesFiles(t *testing.T) {
+	el := testGenerateEntityList()
+	const dscContents = "Source: hello\nFiles:\n 00 4 hello_2.10.orig.tar.gz\n"
+	tests := []struct {
+		dsc     []byte
+		keyring openpgp.KeyRing
+		modify  func(*SourcePackage)
+	}{
+		{ // signed by unknown key
+			dsc:     testSignDsc(t, el, dscContents),
+			keyring: testGenerateEntityList(),
+		},
+		{ // not signed
+			dsc:     []byte(dscContents),
+			keyring: el,
+		},
+		{ // checksum mismatch
+			dsc: []byte(dscContents),
+			modify: func(src *SourcePackage) {
+				src.ChecksumsSHA256[1].HashSum = make([]byte, 32)
+			},
+		},
+		{ // file not listed in index
+			dsc: []byte(dscContents),
+			modify: func(src *SourcePackage) {
+				src.ChecksumsSHA256 = src.ChecksumsSHA256[:1]
+			},
+		},
+		{ // path traversal
+			dsc: []byte("Source: hello\nFiles:\n 00 4 ../hello_2.10.orig.tar.gz\n"),
+		},
+		{ // weak checksums only
+			dsc: []byte(dscContents),
+			modify: func(src *SourcePackage) {
+				src.ChecksumsSHA256 = nil
+			},
+		},
+	}
+	for i, test := range tests {
+		server, repo, src := newTestSourceServer(t, map[string][]byte{
+			"hello_2.10-1.dsc":       test.dsc,
+			"hello_2.10.orig.tar.gz": []byte("orig"),
+		})
+		if test.modify != nil {
+			test.modify(src)
+		}
+		dir, err := ioutil.TempDir("", "debrepo")
+		if err != nil {
+			t.Fatalf("unexpected error creating temp dir: %v", err)
+		}
+		client := newTestValidClient()
+		_, err = client.DownloadSource(context.Background(), repo, src, dir, test.keyring)
+		infos, _ := ioutil.ReadDir(dir)
+		server.Close()
+		os.RemoveAll(dir)
+		if err == nil {
+			t.Fatalf("test(%v): expected error", i)
+		}
+		if len(infos) != 0 {
+			t.Fatalf("test(%v): expected failed download to be removed, found %v files", i, len(infos))
+		}
+	}
+}
+
+// newTestSourceServer returns a server serving files from the directory of
+// the returned source package, which lists files and their checksums.
+func newTestSourceServer(t *testing.T, files map[string][]byte) (*httptest.Server, *Repository, *SourcePackage) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		contents, ok := files[strings.TrimPrefix(r.URL.Path, "/debian/pool/main/h/hello/")]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write(contents)
+	}))
+	repo, _ := ParseRepository("deb-src " + server.URL + "/debian/ xenial main")
+	src := &SourcePackage{Package: "hello", Directory: "pool/main/h/hello"}
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		sum := sha256.Sum256(files[name])
+		src.ChecksumsSHA256 = append(src.ChecksumsSHA256, SourceFile{HashSum: sum[:], Size: int64(len(files[name])), Name: name})
+	}
+	return server, repo, src
+}
+
+func testSignDsc(t *testing.T, el openpgp.EntityList, contents string) []byte {
+	buf := &bytes.Buffer{}
+	w, err := clearsign.Encode(buf, el[0].PrivateKey, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.WriteString(w, contents); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func newTestPackageServer(t *testing.T, contents []byte) (*httptest.Server, *Repository, *Package) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if expected, actual := "/ubuntu/pool/main/f/foo/foo_1.0_amd64.deb", r.URL.Path; expected != actual {
+			t.Errorf("request url: expected=%v actual=%v", expected, actual)
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write(contents)
+	}))
+	repo, _ := ParseRepository("deb " + server.URL + "/ubuntu/ xenial main")
+	sum := sha256.Sum256(contents)
+	pkg := &Package{
+		Package:  "foo",
+		Filename: "pool/main/f/foo/foo_1.0_amd64.deb",
+		Size:     int64(len(contents)),
+		SHA256:   sum[:],
+	}
+	return server, repo, pkg
+}
+
 func getFileInRelease(t *testing.T, inRelease []byte) func(context.Context, string) ([]byte, error) {
 	return func(ctx context.Context, url string) ([]byte, error) {
 		if url != "InRelease" {
@@ -217,10 +821,14 @@ func (tkr *testKeyRing) KeyRing() openpgp.KeyRing {
 }
 
 func newTestKeyRingAndRelease() (inRelease, release, releaseGPG []byte, keyRing KeyRing) {
+	return newTestKeyRingAndSignedRelease([]byte("Origin: Test\n"))
+}
+
+func newTestKeyRingAndSignedRelease(contents []byte) (inRelease, release, releaseGPG []byte, keyRing KeyRing) {
+	release = contents
 	el := testGenerateEntityList()
 	key := el[0].PrivateKey
 	keyRing = &testKeyRing{el}
-	release = []byte("Release File Contents\n")
 
 	inReleaseBuf := &bytes.Buffer{}
 	inReleaseW, err := clearsign.Encode(inReleaseBuf, key, nil)
@@ -0,0 +1,229 @@
+package debrepo
+
+import (
+	"bufio"
+	"io"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ContentsEntry is a line of a Contents index, listing the packages which
+// ship the file at Path. Path is relative to the root directory and has no
+// leading slash.
+type ContentsEntry struct {
+	Path      string
+	Locations []ContentsLocation
+}
+
+// ContentsLocation is a package shipping a file listed in a Contents index.
+// Section is the section of the package, which may be qualified by its area,
+// such as "universe/admin".
+type ContentsLocation struct {
+	Section string
+	Package string
+}
+
+func (l ContentsLocation) String() string {
+	return l.Section + "/" + l.Package
+}
+
+// contentsHeaderLines is the maximum number of lines searched for the
+// "FILE LOCATION" line which ends the header of old style Contents indexes.
+const contentsHeaderLines = 100
+
+// ContentsReader reads the entries of a Contents index. The free-form header
+// of older indexes, ending with a "FILE LOCATION" line, is skipped.
+type ContentsReader struct {
+	r       *bufio.Reader
+	started bool
+	pending []string
+	line    int
+}
+
+// NewContentsReader returns a ContentsReader which reads from r.
+func NewContentsReader(r io.Reader) *ContentsReader {
+	return &ContentsReader{r: bufio.NewReader(r)}
+}
+
+// Read returns the next entry. It returns io.EOF after the last entry and a
+// *ParseError for a malformed line.
+func (cr *ContentsReader) Read() (*ContentsEntry, error) {
+	if !cr.started {
+		if err := cr.skipHeader(); err != nil {
+			return nil, err
+		}
+	}
+	for {
+		var line string
+		if len(cr.pending) != 0 {
+			line, cr.pending = cr.pending[0], cr.pending[1:]
+		} else {
+			var err error
+			if line, err = cr.readLine(); err != nil {
+				return nil, err
+			}
+		}
+		cr.line++
+		if len(strings.TrimSpace(line)) == 0 {
+			continue
+		}
+		entry, err := parseContentsLine(line)
+		if err != nil {
+			return nil, &ParseError{Line: cr.line, Err: err}
+		}
+		return entry, nil
+	}
+}
+
+// readLine returns the next line without its line ending. It returns io.EOF
+// at the end of the index.
+func (cr *ContentsReader) readLine() (string, error) {
+	line, err := cr.r.ReadString('\n')
+	if err == io.EOF && len(line) != 0 {
+		err = nil
+	}
+	return strings.TrimRight(line, "\r\n"), err
+}
+
+// skipHeader discards the header of old style indexes. Lines read while
+// looking for the end of the header are kept to be returned as entries if the
+// index has no header.
+func (cr *ContentsReader) skipHeader() error {
+	cr.started = true
+	for i := 0; i < contentsHeaderLines; i++ {
+		line, err := cr.readLine()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		cr.pending = append(cr.pending, line)
+		if fields := strings.Fields(line); len(fields) == 2 && fields[0] == "FILE" && fields[1] == "LOCATION" {
+			cr.line += len(cr.pending)
+			cr.pending = nil
+			return nil
+		}
+	}
+	return nil
+}
+
+// parseContentsLine parses a line of a Contents index. The path may contain
+// spaces; it is separated from the comma separated list of locations by the
+// last run of whitespace on the line.
+func parseContentsLine(line string) (*ContentsEntry, error) {
+	line = strings.TrimRight(line, " \t")
+	i := strings.LastIndexAny(line, " \t")
+	if i < 0 {
+		return nil, errors.Errorf("missing location: %q", line)
+	}
+	entry := &ContentsEntry{
+		Path: strings.TrimPrefix(strings.TrimRight(line[:i], " \t"), "/"),
+	}
+	if len(entry.Path) == 0 {
+		return nil, errors.Errorf("missing path: %q", line)
+	}
+	for _, location := range strings.Split(line[i+1:], ",") {
+		j := strings.LastIndexByte(location, '/')
+		if j <= 0 || j == len(location)-1 {
+			return nil, errors.Errorf("invalid location %q", location)
+		}
+		entry.Locations = append(entry.Locations, ContentsLocation{
+			Section: location[:j],
+			Package: location[j+1:],
+		})
+	}
+	return entry, nil
+}
+
+// FilePattern selects paths from a Contents index. See ExactPath, GlobPath and
+// RegexpPath.
+type FilePattern interface {
+	// MatchPath returns true if the path, as listed in a Contents index
+	// without a leading slash, matches the pattern.
+	MatchPath(path string) bool
+}
+
+type exactPath string
+
+func (p exactPath) MatchPath(path string) bool {
+	return string(p) == path
+}
+
+type regexpPath struct {
+	re *regexp.Regexp
+}
+
+func (p regexpPath) MatchPath(path string) bool {
+	return p.re.MatchString("/" + path)
+}
+
+// ExactPath returns a FilePattern matching the file at path. A leading slash
+// is optional.
+func ExactPath(path string) FilePattern {
+	return exactPath(strings.TrimPrefix(path, "/"))
+}
+
+// GlobPath returns a FilePattern matching paths against the shell pattern
+// glob. Unlike path.Match, the wildcards "*" and "?" also match slashes, as
+// in apt-file. "[...]" matches a character class, which is negated by a
+// leading "!"; a "]" directly after the "[" or "[!" is part of the class.
+// Patterns are matched against the whole path; a leading slash is optional.
+func GlobPath(glob string) (FilePattern, error) {
+	glob = strings.TrimPrefix(glob, "/")
+	expr := "^/"
+	for i := 0; i < len(glob); i++ {
+		switch c := glob[i]; c {
+		case '*':
+			expr += ".*"
+		case '?':
+			expr += "."
+		case '[':
+			start, negate := i+1, false
+			if start < len(glob) && glob[start] == '!' {
+				start, negate = start+1, true
+			}
+			// A "]" at the start of the class is a literal.
+			from := start
+			if from < len(glob) && glob[from] == ']' {
+				from++
+			}
+			j := strings.IndexByte(glob[from:], ']')
+			if j < 0 {
+				return nil, errors.Errorf("invalid glob %q: unterminated character class", glob)
+			}
+			end := from + j
+			class := strings.NewReplacer(`\`, `\\`, "[", `\[`, "]", `\]`).Replace(glob[start:end])
+			if negate {
+				class = "^" + class
+			}
+			expr += "[" + class + "]"
+			i = end
+		case '\\':
+			if i+1 < len(glob) {
+				i++
+			}
+			expr += regexp.QuoteMeta(glob[i : i+1])
+		default:
+			expr += regexp.QuoteMeta(string(c))
+		}
+	}
+	re, err := regexp.Compile(expr + "$")
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid glob %q", glob)
+	}
+	return regexpPath{re}, nil
+}
+
+// RegexpPath returns a FilePattern matching paths containing a match of the
+// regular expression expr. Paths are matched with a leading slash, as apt-file
+// does, so "^/usr/bin/" matches files in /usr/bin.
+func RegexpPath(expr string) (FilePattern, error) {
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, err
+	}
+	return regexpPath{re}, nil
+}
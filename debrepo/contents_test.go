@@ -0,0 +1,129 @@
+package debrepo
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+	"testing"
+)
+
+const testContentsHeader = `This file maps each file available in the Ubuntu
+system to the package from which it originates.  It includes packages
+from the DIST distribution for the ARCH architecture.
+
+You can use this list to determine which package contains a specific
+file, or whether or not a specific file is available.
+
+FILE                                                    LOCATION
+`
+
+const testContents = `bin/bash                                                shells/bash
+usr/bin/[                                               utils/coreutils
+usr/share/doc/My Program/README                         universe/misc/my-program
+usr/share/man/man1/ls.1.gz                              utils/coreutils,universe/utils/busybox
+`
+
+func TestContentsReader_ReadsBothFormats(t *testing.T) {
+	expected := []*ContentsEntry{
+		{"bin/bash", []ContentsLocation{{"shells", "bash"}}},
+		{"usr/bin/[", []ContentsLocation{{"utils", "coreutils"}}},
+		{"usr/share/doc/My Program/README", []ContentsLocation{{"universe/misc", "my-program"}}},
+		{"usr/share/man/man1/ls.1.gz", []ContentsLocation{{"utils", "coreutils"}, {"universe/utils", "busybox"}}},
+	}
+	for i, input := range []string{testContents, testContentsHeader + testContents} {
+		cr := NewContentsReader(bytes.NewBufferString(input))
+		var actual []*ContentsEntry
+		for {
+			entry, err := cr.Read()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatalf("test(%v): unexpected error: %v", i, err)
+			}
+			actual = append(actual, entry)
+		}
+		if !reflect.DeepEqual(expected, actual) {
+			t.Fatalf("test(%v): expected=%v actual=%v", i, expected, actual)
+		}
+	}
+}
+
+func TestContentsReader_InvalidLine_ReturnsLineNumber(t *testing.T) {
+	tests := []struct {
+		input string
+		line  int
+	}{
+		{"bin/bash shells/bash\nusr/bin/ls\n", 2},
+		{"bin/bash shells/bash\nusr/bin/ls coreutils\n", 2},
+		{testContentsHeader + "bin/bash shells/bash\n\nusr/bin/ls utils/\n", 11},
+	}
+	for i, test := range tests {
+		cr := NewContentsReader(bytes.NewBufferString(test.input))
+		var err error
+		for err == nil {
+			_, err = cr.Read()
+		}
+		parseErr, ok := err.(*ParseError)
+		if !ok {
+			t.Fatalf("test(%v): expected *ParseError, got: %v", i, err)
+		}
+		if expected, actual := test.line, parseErr.Line; expected != actual {
+			t.Fatalf("test(%v): line: expected=%v actual=%v", i, expected, actual)
+		}
+	}
+}
+
+func TestFilePattern_MatchPath(t *testing.T) {
+	glob := func(s string) FilePattern {
+		p, err := GlobPath(s)
+		if err != nil {
+			t.Fatalf("unexpected error compiling glob %q: %v", s, err)
+		}
+		return p
+	}
+	re := func(s string) FilePattern {
+		p, err := RegexpPath(s)
+		if err != nil {
+			t.Fatalf("unexpected error compiling regexp %q: %v", s, err)
+		}
+		return p
+	}
+	tests := []struct {
+		pattern FilePattern
+		path    string
+		match   bool
+	}{
+		{ExactPath("/usr/bin/ls"), "usr/bin/ls", true},
+		{ExactPath("usr/bin/ls"), "usr/bin/lsblk", false},
+		{glob("*/bin/ls"), "usr/bin/ls", true},
+		{glob("*ls"), "usr/bin/ls", true},
+		{glob("/usr/bin/l?"), "usr/bin/ls", true},
+		{glob("usr/bin/[a-m]s"), "usr/bin/ls", true},
+		{glob("usr/bin/[!a-m]s"), "usr/bin/ls", false},
+		{glob(`usr/bin/\[`), "usr/bin/[", true},
+		{glob("usr/bin/l.*"), "usr/bin/ls", false},
+		{glob("a[]b]"), "a]", true},
+		{glob("a[]b]"), "ab", true},
+		{glob("a[]b]"), "ac", false},
+		{glob("a[!]b]"), "a]", false},
+		{glob("a[!]b]"), "ac", true},
+		{glob("a[[]"), "a[", true},
+		{re("^/usr/bin/"), "usr/bin/ls", true},
+		{re("^/usr/bin/"), "usr/local/bin/ls", false},
+		{re(`ls\.1`), "usr/share/man/man1/ls.1.gz", true},
+	}
+	for i, test := range tests {
+		if expected, actual := test.match, test.pattern.MatchPath(test.path); expected != actual {
+			t.Fatalf("test(%v): expected=%v actual=%v", i, expected, actual)
+		}
+	}
+	for _, s := range []string{"usr/bin/[a-", "usr/bin/[]", "usr/bin/[!]"} {
+		if _, err := GlobPath(s); err == nil {
+			t.Fatalf("expected error on unterminated character class: %s", s)
+		}
+	}
+	if _, err := RegexpPath("("); err == nil {
+		t.Fatal("expected error on invalid regexp")
+	}
+}
@@ -0,0 +1,211 @@
+package debrepo
+
+import (
+	"io"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// deb822SourcesOptions maps the fields of a deb822-style sources file to the
+// equivalent options of a one-line style sources.list entry.
+var deb822SourcesOptions = []struct {
+	field  string
+	option string
+}{
+	{"Architectures", "arch"},
+	{"Languages", "lang"},
+	{"Targets", "target"},
+	{"PDiffs", "pdiffs"},
+	{"By-Hash", "by-hash"},
+	{"Allow-Insecure", "allow-insecure"},
+	{"Allow-Weak", "allow-weak"},
+	{"Allow-Downgrade-To-Insecure", "allow-downgrade-to-insecure"},
+	{"Trusted", "trusted"},
+	{"Signed-By", "signed-by"},
+	{"Check-Valid-Until", "check-valid-until"},
+	{"Valid-Until-Min", "valid-until-min"},
+	{"Valid-Until-Max", "valid-until-max"},
+	{"Check-Date", "check-date"},
+	{"Date-Max-Future", "date-max-future"},
+	{"InRelease-Path", "inrelease-path"},
+	{"Snapshot", "snapshot"},
+}
+
+// ParseDeb822Sources parses a deb822-style sources file such as those found
+// in /etc/apt/sources.list.d/*.sources. Each stanza is expanded into one
+// Repository for every combination of its Types, URIs and Suites. Stanzas
+// whose Enabled field is false, such as "Enabled: no", are skipped. Other
+// fields are exposed as repository options using the names of the equivalent
+// one-line style options.
+//
+// A Signed-By field containing an inline ASCII-armored key block is available
+// through Repository.SignedByKey rather than as an option.
+//
+// If a stanza cannot be parsed a *SourcesListError containing the line number
+// of the start of the stanza is returned.
+func ParseDeb822Sources(r io.Reader) (RepositoryList, error) {
+	var list RepositoryList
+	pr := NewParagraphReader(r)
+	for {
+		stanza, err := pr.Read()
+		if err == io.EOF {
+			return list, nil
+		}
+		if parseErr, ok := err.(*ParseError); ok {
+			return nil, &SourcesListError{Line: parseErr.Line, Err: parseErr.Err}
+		}
+		if err != nil {
+			return nil, err
+		}
+		repos, err := parseDeb822SourcesStanza(stanza)
+		if err != nil {
+			return nil, &SourcesListError{Line: pr.Line(), Err: err}
+		}
+		list = append(list, repos...)
+	}
+}
+
+func parseDeb822SourcesStanza(stanza Fields) (RepositoryList, error) {
+	if value, ok := stanza.Lookup("Enabled"); ok {
+		enabled, err := parseAptBool(value)
+		if err != nil {
+			return nil, errors.Wrapf(ErrInvalidRepository, "Enabled field: %v", err)
+		}
+		if !enabled {
+			return nil, nil
+		}
+	}
+	types := strings.Fields(stanza.Get("Types"))
+	uris := strings.Fields(stanza.Get("URIs"))
+	suites := strings.Fields(stanza.Get("Suites"))
+	var components []string
+	if value := stanza.Get("Components"); len(strings.TrimSpace(value)) != 0 {
+		components = strings.Fields(value)
+	}
+	switch {
+	case len(types) == 0:
+		return nil, errors.Wrap(ErrInvalidRepository, "missing Types field")
+	case len(uris) == 0:
+		return nil, errors.Wrap(ErrInvalidRepository, "missing URIs field")
+	case len(suites) == 0:
+		return nil, errors.Wrap(ErrInvalidRepository, "missing Suites field")
+	}
+	for _, t := range types {
+		if t != "deb" && t != "deb-src" {
+			return nil, errors.Wrapf(ErrInvalidRepository, "unknown type %q", t)
+		}
+	}
+	for _, uri := range uris {
+		if !isURL(uri) {
+			return nil, errors.Wrapf(ErrInvalidRepository, "invalid URI %q", uri)
+		}
+	}
+
+	var options []RepositoryOption
+	var signedByKey string
+	for _, o := range deb822SourcesOptions {
+		ops := []struct{ suffix, op string }{{"", "="}, {"-Add", "+="}, {"-Remove", "-="}}
+		for _, op := range ops {
+			value, ok := stanza.Lookup(o.field + op.suffix)
+			if !ok {
+				continue
+			}
+			if o.field == "Signed-By" && strings.Contains(value, "-----BEGIN PGP") {
+				signedByKey = strings.TrimSpace(value) + "\n"
+				continue
+			}
+			options = append(options, RepositoryOption{
+				Key:    o.option,
+				Op:     op.op,
+				Values: splitOptionValues(value),
+			})
+		}
+	}
+
+	var list RepositoryList
+	for _, t := range types {
+		for _, uri := range uris {
+			for _, suite := range suites {
+				r := &Repository{
+					repoType:     t,
+					options:      options,
+					baseURI:      uri,
+					distribution: suite,
+					components:   components,
+					signedByKey:  signedByKey,
+				}
+				if err := r.validateComponents(); err != nil {
+					return nil, err
+				}
+				list = append(list, r)
+			}
+		}
+	}
+	return list, nil
+}
+
+// splitOptionValues splits a deb822 field value into option values. Values
+// may be separated by whitespace or commas.
+func splitOptionValues(value string) []string {
+	return strings.FieldsFunc(value, func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\t' || r == '\n'
+	})
+}
+
+// WriteDeb822Sources writes list to w as a deb822-style sources file. Each
+// Repository is written as its own stanza.
+func WriteDeb822Sources(w io.Writer, list RepositoryList) error {
+	pw := NewParagraphWriter(w)
+	for _, r := range list {
+		if r == nil || r.isZero() {
+			return errors.New("empty repository in list")
+		}
+		stanza := Fields{
+			{"Types", r.repoType},
+			{"URIs", r.baseURI},
+			{"Suites", r.distribution},
+		}
+		if len(r.components) != 0 {
+			stanza = append(stanza, Field{"Components", strings.Join(r.components, " ")})
+		}
+		for _, o := range r.options {
+			field := deb822SourcesField(o.Key)
+			switch o.Op {
+			case "+=":
+				field += "-Add"
+			case "-=":
+				field += "-Remove"
+			}
+			stanza = append(stanza, Field{field, strings.Join(o.Values, " ")})
+		}
+		if len(r.signedByKey) != 0 {
+			var lines []string
+			for _, line := range strings.Split(strings.TrimSpace(r.signedByKey), "\n") {
+				lines = append(lines, strings.TrimSpace(line))
+			}
+			stanza = append(stanza, Field{"Signed-By", "\n" + strings.Join(lines, "\n")})
+		}
+		if err := pw.Write(stanza); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deb822SourcesField returns the deb822 field name for a one-line style
+// option. Unknown options are returned with each word capitalized.
+func deb822SourcesField(option string) string {
+	for _, o := range deb822SourcesOptions {
+		if o.option == option {
+			return o.field
+		}
+	}
+	words := strings.Split(option, "-")
+	for i, w := range words {
+		if len(w) != 0 {
+			words[i] = strings.ToUpper(w[:1]) + w[1:]
+		}
+	}
+	return strings.Join(words, "-")
+}
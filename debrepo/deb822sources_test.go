@@ -0,0 +1,164 @@
+package debrepo
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+const testDeb822Sources = `# Ubuntu sources
+Types: deb deb-src
+URIs: http://archive.ubuntu.com/ubuntu/
+Suites: xenial xenial-updates
+Components: main restricted
+Architectures: amd64 i386
+Languages-Add: de
+
+Enabled: no
+Types: deb
+URIs: http://disabled.example.com/ubuntu
+Suites: xenial
+Components: main
+
+types: deb
+uris: http://ppa.example.com/ubuntu
+suites: xenial
+components: main
+Signed-By:
+ -----BEGIN PGP PUBLIC KEY BLOCK-----
+ .
+ mQINBFufwdoBEADv/Gxytx/LcSXYuM0MwKojbBye81s0G1nEx+lz6VAUpIUZnbkq
+ =mu4w
+ -----END PGP PUBLIC KEY BLOCK-----
+`
+
+const testDeb822SourcesKey = `-----BEGIN PGP PUBLIC KEY BLOCK-----
+
+mQINBFufwdoBEADv/Gxytx/LcSXYuM0MwKojbBye81s0G1nEx+lz6VAUpIUZnbkq
+=mu4w
+-----END PGP PUBLIC KEY BLOCK-----
+`
+
+func TestParseDeb822Sources(t *testing.T) {
+	list, err := ParseDeb822Sources(bytes.NewBufferString(testDeb822Sources))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := []string{
+		"deb [arch=amd64,i386 lang+=de] http://archive.ubuntu.com/ubuntu/ xenial main restricted",
+		"deb [arch=amd64,i386 lang+=de] http://archive.ubuntu.com/ubuntu/ xenial-updates main restricted",
+		"deb-src [arch=amd64,i386 lang+=de] http://archive.ubuntu.com/ubuntu/ xenial main restricted",
+		"deb-src [arch=amd64,i386 lang+=de] http://archive.ubuntu.com/ubuntu/ xenial-updates main restricted",
+		"deb http://ppa.example.com/ubuntu xenial main",
+	}
+	var actual []string
+	for _, repo := range list {
+		actual = append(actual, repo.String())
+	}
+	if !reflect.DeepEqual(expected, actual) {
+		t.Fatalf("\nexpected=%v\nactual=%v", expected, actual)
+	}
+	if expected, actual := testDeb822SourcesKey, list[4].SignedByKey(); expected != actual {
+		t.Fatalf("signed-by key:\nexpected=%q\nactual=%q", expected, actual)
+	}
+}
+
+func TestParseDeb822Sources_FlatRepository(t *testing.T) {
+	list, err := ParseDeb822Sources(bytes.NewBufferString("Types: deb\nURIs: http://example.com/debian\nSuites: ./\n"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if expected, actual := "deb http://example.com/debian ./", list[0].String(); expected != actual {
+		t.Fatalf("expected=%v actual=%v", expected, actual)
+	}
+	buf := &bytes.Buffer{}
+	WriteDeb822Sources(buf, list)
+	if expected, actual := "Types: deb\nURIs: http://example.com/debian\nSuites: ./\n", buf.String(); expected != actual {
+		t.Fatalf("expected=%q actual=%q", expected, actual)
+	}
+}
+
+func TestWriteDeb822Sources_RoundTrips(t *testing.T) {
+	list, _ := ParseDeb822Sources(bytes.NewBufferString(testDeb822Sources))
+	buf := &bytes.Buffer{}
+	if err := WriteDeb822Sources(buf, list); err != nil {
+		t.Fatalf("unexpected error writing: %v", err)
+	}
+	parsed, err := ParseDeb822Sources(bytes.NewBuffer(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("unexpected error parsing written sources: %v\n%s", err, buf.Bytes())
+	}
+	if !reflect.DeepEqual(list, parsed) {
+		t.Fatalf("\nexpected=%v\nactual=%v", list, parsed)
+	}
+}
+
+func TestWriteDeb822Sources(t *testing.T) {
+	repo, _ := ParseRepository("deb [arch=amd64 signed-by=/usr/share/keyrings/x.gpg] http://ppa.example.com/ubuntu xenial main universe")
+	buf := &bytes.Buffer{}
+	if err := WriteDeb822Sources(buf, RepositoryList{repo}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := `Types: deb
+URIs: http://ppa.example.com/ubuntu
+Suites: xenial
+Components: main universe
+Architectures: amd64
+Signed-By: /usr/share/keyrings/x.gpg
+`
+	if actual := buf.String(); expected != actual {
+		t.Fatalf("\nexpected=%s\nactual=%s", expected, actual)
+	}
+}
+
+var deb822SourcesErrorTests = []struct {
+	input string
+	line  int
+}{
+	{"Types: deb\nURIs: http://a/\nSuites: xenial\n", 1},
+	{"Types: deb\nURIs: http://a/\nSuites: xenial\nComponents: main\n\n\nTypes: rpm\nURIs: http://a/\nSuites: xenial\nComponents: main\n", 7},
+	{"Types: deb\nURIs: notaurl\nSuites: xenial\nComponents: main\n", 1},
+	{"Types: deb\n continuation\nbad line\n", 3},
+	{" continuation\n", 1},
+	{"Types: deb\nTypes: deb-src\n", 2},
+	{"Types: deb\nURIs: http://a/\nSuites: ./\nComponents: main\n", 1},
+	{"Enabled: maybe\nTypes: deb\nURIs: http://a/\nSuites: xenial\nComponents: main\n", 1},
+}
+
+func TestParseDeb822Sources_Enabled(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected int
+	}{
+		{"yes", 1},
+		{"True", 1},
+		{"1", 1},
+		{"no", 0},
+		{"false", 0},
+		{"OFF", 0},
+		{"0", 0},
+	}
+	for i, test := range tests {
+		input := "Enabled: " + test.value + "\nTypes: deb\nURIs: http://a/\nSuites: xenial\nComponents: main\n"
+		list, err := ParseDeb822Sources(bytes.NewBufferString(input))
+		if err != nil {
+			t.Fatalf("test(%v): unexpected error: %v", i, err)
+		}
+		if expected, actual := test.expected, len(list); expected != actual {
+			t.Fatalf("test(%v): expected=%v actual=%v", i, expected, actual)
+		}
+	}
+}
+
+func TestParseDeb822Sources_InvalidStanza_ReturnsLineNumber(t *testing.T) {
+	for i, test := range deb822SourcesErrorTests {
+		_, err := ParseDeb822Sources(bytes.NewBufferString(test.input))
+		listErr, ok := err.(*SourcesListError)
+		if !ok {
+			t.Fatalf("test(%v): expected *SourcesListError, got: %v", i, err)
+		}
+		if expected, actual := test.line, listErr.Line; expected != actual {
+			t.Fatalf("test(%v): line: expected=%v actual=%v", i, expected, actual)
+		}
+	}
+}
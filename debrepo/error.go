@@ -1,8 +1,81 @@
 package debrepo
 
+import (
+	"crypto"
+	"fmt"
+)
+
 // Error is a const error type.
 type Error string
 
 func (e Error) Error() string {
 	return string(e)
 }
+
+// ChecksumError is returned when downloaded content does not match the
+// checksum listed for it in an index file.
+type ChecksumError struct {
+	URL      string
+	Hash     crypto.Hash
+	Expected []byte
+	Actual   []byte
+}
+
+func (e *ChecksumError) Error() string {
+	return fmt.Sprintf("checksum mismatch: %s: %s: expected=%x actual=%x", e.URL, hashName(e.Hash), e.Expected, e.Actual)
+}
+
+// SizeError is returned when downloaded content does not match the size
+// listed for it in an index file.
+type SizeError struct {
+	URL      string
+	Expected int64
+	Actual   int64
+}
+
+func (e *SizeError) Error() string {
+	return fmt.Sprintf("size mismatch: %s: expected=%d actual=%d", e.URL, e.Expected, e.Actual)
+}
+
+// hashName returns the name used for hash in index files.
+func hashName(hash crypto.Hash) string {
+	switch hash {
+	case crypto.MD5:
+		return "MD5Sum"
+	case crypto.SHA1:
+		return "SHA1"
+	case crypto.SHA256:
+		return "SHA256"
+	case crypto.SHA512:
+		return "SHA512"
+	}
+	return hash.String()
+}
+
+// SourcesListError is returned when an entry in a sources list cannot be
+// parsed. Line is the 1-based line number of the entry.
+type SourcesListError struct {
+	Line int
+	Err  error
+}
+
+func (e *SourcesListError) Error() string {
+	return fmt.Sprintf("sources list line %d: %v", e.Line, e.Err)
+}
+
+// SignatureThresholdError is returned when a Release file has fewer valid
+// signatures from distinct trusted signers than required by a SignaturePolicy.
+// Failed lists the signatures which could not be verified.
+type SignatureThresholdError struct {
+	Required int
+	Valid    int
+	Failed   []SignatureResult
+}
+
+func (e *SignatureThresholdError) Error() string {
+	msg := fmt.Sprintf("%d of %d required signatures valid", e.Valid, e.Required)
+	for _, s := range e.Failed {
+		msg += fmt.Sprintf("; key %016X: %v", s.KeyID, s.Err)
+	}
+	return msg
+}
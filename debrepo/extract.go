@@ -0,0 +1,617 @@
+package debrepo
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/ulikunitz/xz"
+)
+
+const (
+	// ErrUnsafePath is returned by ExtractSource when a tarball or patch
+	// refers to a path outside the extraction directory, through a symbolic
+	// link, or creates a symbolic link to an absolute path or outside the
+	// extraction directory.
+	ErrUnsafePath = Error("unsafe path in source package")
+)
+
+// ExtractSource unpacks the source package described by the .dsc file at
+// dscPath into dir, as "dpkg-source -x" does. The files listed in the .dsc
+// file are read from the directory containing it, such as the directory
+// passed to Client.DownloadSource. The signature of the .dsc file is not
+// checked. dir must not exist.
+//
+// The following source formats are supported:
+//
+//   - 3.0 (native): the tarball is unpacked.
+//   - 3.0 (quilt): the orig tarball is unpacked, followed by each component
+//     tarball into a directory named after its component. The debian tarball,
+//     which may only contain the debian directory, replaces the debian
+//     directory and the patches listed in debian/patches/series are applied
+//     in order.
+//   - 1.0: the orig tarball is unpacked and the .diff.gz applied, or the
+//     native tarball is unpacked if there is no diff.
+//
+// As with dpkg-source, each file listed in the .dsc file is first checked
+// against its size and the strongest checksum listed for it, and a *SizeError
+// or *ChecksumError is returned on mismatch. The top-level directory of the
+// orig, component and native tarballs is removed if it is the only entry.
+// Tarballs may be compressed with gzip, xz or bzip2. An error wrapping
+// ErrUnsafePath is returned if the package tries to write outside dir or
+// leaves a symbolic link resolving outside dir; dir is removed if an error is
+// returned.
+func ExtractSource(dscPath, dir string) (err error) {
+	b, err := ioutil.ReadFile(dscPath)
+	if err != nil {
+		return err
+	}
+	dsc, err := readDsc(b, nil, SignaturePolicy{})
+	if err != nil {
+		return errors.Wrap(err, dscPath)
+	}
+	files, err := classifySourceFiles(dsc)
+	if err != nil {
+		return err
+	}
+	srcDir := filepath.Dir(dscPath)
+	for _, f := range dsc.Files {
+		if err := checkSourceFile(dsc, filepath.Join(srcDir, f.Name)); err != nil {
+			return err
+		}
+	}
+	if _, err := os.Lstat(dir); err == nil {
+		return errors.Errorf("extraction directory already exists: %s", dir)
+	}
+	if err := os.Mkdir(dir, 0755); err != nil {
+		return err
+	}
+	defer func() {
+		// Links are checked as they are unpacked, but later entries may
+		// change the paths they resolve through.
+		if err == nil {
+			err = checkSymlinks(dir)
+		}
+		if err != nil {
+			os.RemoveAll(dir)
+		}
+	}()
+
+	switch format := dsc.Fields.Get("Format"); format {
+	case "3.0 (native)":
+		if len(files.native) == 0 {
+			return errors.Errorf("%s: no tarball listed", dscPath)
+		}
+		return extractUpstreamTarball(filepath.Join(srcDir, files.native), dir, "")
+	case "3.0 (quilt)":
+		if len(files.orig) == 0 || len(files.debian) == 0 {
+			return errors.Errorf("%s: orig and debian tarballs required for format %s", dscPath, format)
+		}
+		if err := extractUpstreamTarball(filepath.Join(srcDir, files.orig), dir, ""); err != nil {
+			return err
+		}
+		for _, c := range files.components {
+			componentDir, err := securePath(dir, c.component)
+			if err != nil {
+				return err
+			}
+			if err := os.RemoveAll(componentDir); err != nil {
+				return err
+			}
+			if err := os.Mkdir(componentDir, 0755); err != nil {
+				return err
+			}
+			if err := extractUpstreamTarball(filepath.Join(srcDir, c.name), dir, c.component+"/"); err != nil {
+				return err
+			}
+		}
+		debianDir, err := securePath(dir, "debian")
+		if err != nil {
+			return err
+		}
+		if err := os.RemoveAll(debianDir); err != nil {
+			return err
+		}
+		// As with dpkg-source, the debian tarball may only contain the
+		// debian directory.
+		if err := extractTarball(filepath.Join(srcDir, files.debian), dir, "debian/", "debian/"); err != nil {
+			return err
+		}
+		return applyQuiltSeries(dir)
+	case "1.0", "":
+		if len(files.diff) == 0 {
+			if len(files.native) == 0 {
+				return errors.Errorf("%s: no tarball listed", dscPath)
+			}
+			return extractUpstreamTarball(filepath.Join(srcDir, files.native), dir, "")
+		}
+		if len(files.orig) == 0 {
+			return errors.Errorf("%s: orig tarball required with diff", dscPath)
+		}
+		if err := extractUpstreamTarball(filepath.Join(srcDir, files.orig), dir, ""); err != nil {
+			return err
+		}
+		if err := applyCompressedPatch(filepath.Join(srcDir, files.diff), dir); err != nil {
+			return err
+		}
+		// Diffs cannot carry file modes; dpkg-source makes the rules file
+		// executable.
+		if rules, err := securePath(dir, "debian/rules"); err == nil {
+			if fi, err := os.Lstat(rules); err == nil && fi.Mode().IsRegular() {
+				return os.Chmod(rules, 0755)
+			}
+		}
+		return nil
+	default:
+		return errors.Errorf("%s: unsupported source format %q", dscPath, format)
+	}
+}
+
+// checkSourceFile checks the file at filename against the size and strongest
+// checksum listed for it in dsc.
+func checkSourceFile(dsc *SourcePackage, filename string) error {
+	meta, ok, err := dsc.fileMeta(filepath.Base(filename))
+	if err != nil {
+		return err
+	}
+	h, expected, found := meta.StrongestHash(true)
+	if !ok || !found {
+		return errors.Errorf("no checksum listed for %s", filepath.Base(filename))
+	}
+	f, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	hw := h.New()
+	n, err := io.Copy(hw, f)
+	if err != nil {
+		return err
+	}
+	if n != meta.Size {
+		return &SizeError{URL: filename, Expected: meta.Size, Actual: n}
+	}
+	if actual := hw.Sum(nil); !bytes.Equal(actual, expected) {
+		return &ChecksumError{URL: filename, Hash: h, Expected: expected, Actual: actual}
+	}
+	return nil
+}
+
+// sourceFiles holds the names of the files of a source package by their role.
+type sourceFiles struct {
+	orig       string
+	components []componentTarball
+	debian     string
+	native     string
+	diff       string
+}
+
+type componentTarball struct {
+	component string
+	name      string
+}
+
+// classifySourceFiles sorts the files listed in dsc by their role. Upstream
+// signatures are ignored.
+func classifySourceFiles(dsc *SourcePackage) (*sourceFiles, error) {
+	files := &sourceFiles{}
+	for _, f := range dsc.Files {
+		name := f.Name
+		var dst *string
+		switch {
+		case strings.HasSuffix(name, ".asc"):
+			continue
+		case strings.HasSuffix(name, ".diff.gz"):
+			dst = &files.diff
+		case strings.Contains(name, ".debian.tar."):
+			dst = &files.debian
+		case strings.Contains(name, ".orig.tar."):
+			dst = &files.orig
+		case strings.Contains(name, ".orig-") && strings.Contains(name, ".tar."):
+			component := name[strings.Index(name, ".orig-")+len(".orig-") : strings.Index(name, ".tar.")]
+			if len(component) == 0 || strings.ContainsAny(component, "/.") {
+				return nil, errors.Errorf("invalid component tarball name %q", name)
+			}
+			files.components = append(files.components, componentTarball{component, name})
+			continue
+		case strings.Contains(name, ".tar."):
+			dst = &files.native
+		default:
+			return nil, errors.Errorf("unknown source file %q", name)
+		}
+		if len(*dst) != 0 {
+			return nil, errors.Errorf("more than one file of the same kind: %s, %s", *dst, name)
+		}
+		*dst = name
+	}
+	return files, nil
+}
+
+// securePath returns the path of name within root. An error wrapping
+// ErrUnsafePath is returned if name is absolute, refers to a path outside
+// root or has a parent within root which is a symbolic link. The final
+// component of name may be a symbolic link.
+func securePath(root, name string) (string, error) {
+	if path.IsAbs(name) {
+		return "", errors.Wrapf(ErrUnsafePath, "absolute path %s", name)
+	}
+	clean := path.Clean(name)
+	if clean == ".." || strings.HasPrefix(clean, "../") {
+		return "", errors.Wrapf(ErrUnsafePath, "path outside extraction directory %s", name)
+	}
+	if clean == "." {
+		return root, nil
+	}
+	parts := strings.Split(clean, "/")
+	dir := root
+	for _, part := range parts[:len(parts)-1] {
+		dir = filepath.Join(dir, part)
+		fi, err := os.Lstat(dir)
+		if err != nil {
+			if os.IsNotExist(err) {
+				break
+			}
+			return "", err
+		}
+		if fi.Mode()&os.ModeSymlink != 0 {
+			return "", errors.Wrapf(ErrUnsafePath, "path through symbolic link %s", name)
+		}
+	}
+	return filepath.Join(root, filepath.FromSlash(clean)), nil
+}
+
+// openCompressed opens filename and decompresses it according to its
+// extension.
+func openCompressed(filename string) (io.Reader, io.Closer, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, nil, err
+	}
+	var r io.Reader = bufio.NewReader(f)
+	switch path.Ext(filename) {
+	case ".gz":
+		r, err = gzip.NewReader(r)
+	case ".xz":
+		r, err = xz.NewReader(r)
+	case ".bz2":
+		r = bzip2.NewReader(r)
+	case ".tar":
+	default:
+		err = errors.Errorf("unsupported compression: %s", filename)
+	}
+	if err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+	return r, f, nil
+}
+
+// tarballPrefix returns the top-level directory of the tarball, including its
+// trailing slash, if it is the only top-level entry. Otherwise it returns an
+// empty string.
+func tarballPrefix(filename string) (string, error) {
+	r, c, err := openCompressed(filename)
+	if err != nil {
+		return "", err
+	}
+	defer c.Close()
+	tr := tar.NewReader(r)
+	var top string
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", errors.Wrap(err, filename)
+		}
+		if h.Typeflag == tar.TypeXGlobalHeader {
+			continue
+		}
+		name := strings.TrimPrefix(h.Name, "./")
+		if len(name) == 0 {
+			continue
+		}
+		i := strings.IndexByte(name, '/')
+		if i < 0 {
+			if h.Typeflag != tar.TypeDir {
+				return "", nil
+			}
+			i = len(name)
+		}
+		if len(top) != 0 && name[:i] != top {
+			return "", nil
+		}
+		top = name[:i]
+	}
+	if len(top) == 0 || top == "." || top == ".." {
+		return "", nil
+	}
+	return top + "/", nil
+}
+
+// extractUpstreamTarball unpacks the tarball filename into dest within dir,
+// removing the single top-level directory of the tarball from the names of
+// its entries.
+func extractUpstreamTarball(filename, dir, dest string) error {
+	prefix, err := tarballPrefix(filename)
+	if err != nil {
+		return err
+	}
+	return extractTarball(filename, dir, prefix, dest)
+}
+
+// extractTarball unpacks the tarball filename into dir. The names of its
+// entries must start with prefix, which is replaced by dest. Entries replace
+// existing files. File modes are limited to their permission bits.
+func extractTarball(filename, dir, prefix, dest string) error {
+	r, c, err := openCompressed(filename)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	tr := tar.NewReader(r)
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return errors.Wrap(err, filename)
+		}
+		if err := extractTarEntry(tr, h, dir, prefix, dest); err != nil {
+			return errors.Wrapf(err, "%s: %s", filepath.Base(filename), h.Name)
+		}
+	}
+}
+
+func extractTarEntry(tr *tar.Reader, h *tar.Header, dir, prefix, dest string) error {
+	if h.Typeflag == tar.TypeXGlobalHeader {
+		return nil
+	}
+	name, err := tarEntryName(h.Name, prefix, dest)
+	if err != nil || len(name) == 0 {
+		return err
+	}
+	target, err := securePath(dir, name)
+	if err != nil {
+		return err
+	}
+	if h.Typeflag == tar.TypeDir {
+		if fi, err := os.Lstat(target); err == nil && fi.IsDir() {
+			return nil
+		}
+		if err := removeExisting(target); err != nil {
+			return err
+		}
+		return os.MkdirAll(target, 0755)
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	if err := removeExisting(target); err != nil {
+		return err
+	}
+	switch h.Typeflag {
+	case tar.TypeReg, tar.TypeRegA:
+		f, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_EXCL, os.FileMode(h.Mode).Perm())
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(f, tr); err != nil {
+			f.Close()
+			return err
+		}
+		return f.Close()
+	case tar.TypeSymlink:
+		if err := checkSymlink(dir, name, h.Linkname); err != nil {
+			return err
+		}
+		return os.Symlink(h.Linkname, target)
+	case tar.TypeLink:
+		linkname, err := tarEntryName(h.Linkname, prefix, dest)
+		if err != nil {
+			return err
+		}
+		oldname, err := securePath(dir, linkname)
+		if err != nil {
+			return err
+		}
+		if fi, err := os.Lstat(oldname); err != nil || !fi.Mode().IsRegular() {
+			return errors.Wrapf(ErrUnsafePath, "hard link to non-regular file %s", h.Linkname)
+		}
+		return os.Link(oldname, target)
+	}
+	return errors.Errorf("unsupported tar entry type %q", rune(h.Typeflag))
+}
+
+// tarEntryName returns the name of a tar entry within the extraction
+// directory, with prefix replaced by dest. Entries outside prefix are rejected
+// as they would be unpacked outside their directory. An empty name is
+// returned for the prefix directory itself.
+func tarEntryName(name, prefix, dest string) (string, error) {
+	name = strings.TrimPrefix(name, "./")
+	if len(name) == 0 || name+"/" == prefix || name == prefix {
+		return "", nil
+	}
+	if !strings.HasPrefix(name, prefix) {
+		return "", errors.Wrapf(ErrUnsafePath, "entry outside %s", prefix)
+	}
+	return dest + strings.TrimPrefix(name, prefix), nil
+}
+
+// maxSymlinks is the number of symbolic links followed by checkSymlink before
+// it gives up, as with ELOOP.
+const maxSymlinks = 255
+
+// checkSymlink returns an error wrapping ErrUnsafePath if a symbolic link at
+// name within root pointing to linkname would resolve outside root. Symbolic
+// links already in root are followed. As any path may be created by a later
+// entry, ".." is rejected after a path which does not exist or is not a
+// directory.
+func checkSymlink(root, name, linkname string) error {
+	if path.IsAbs(linkname) {
+		return errors.Wrapf(ErrUnsafePath, "absolute symbolic link to %s", linkname)
+	}
+	pending := strings.Split(path.Dir(name)+"/"+linkname, "/")
+	var resolved []string
+	missing := false
+	links := 0
+	for len(pending) != 0 {
+		part := pending[0]
+		pending = pending[1:]
+		switch part {
+		case "", ".":
+			continue
+		case "..":
+			if missing || len(resolved) == 0 {
+				return errors.Wrapf(ErrUnsafePath, "symbolic link outside extraction directory to %s", linkname)
+			}
+			resolved = resolved[:len(resolved)-1]
+			continue
+		}
+		resolved = append(resolved, part)
+		if missing {
+			continue
+		}
+		p := filepath.Join(root, filepath.Join(resolved...))
+		fi, err := os.Lstat(p)
+		switch {
+		case os.IsNotExist(err):
+			missing = true
+		case err != nil:
+			return err
+		case fi.Mode()&os.ModeSymlink != 0:
+			if links++; links > maxSymlinks {
+				return errors.Wrapf(ErrUnsafePath, "too many levels of symbolic links to %s", linkname)
+			}
+			target, err := os.Readlink(p)
+			if err != nil {
+				return err
+			}
+			if path.IsAbs(target) {
+				return errors.Wrapf(ErrUnsafePath, "absolute symbolic link to %s", target)
+			}
+			resolved = resolved[:len(resolved)-1]
+			pending = append(strings.Split(target, "/"), pending...)
+		case !fi.IsDir():
+			missing = true
+		}
+	}
+	return nil
+}
+
+// checkSymlinks checks every symbolic link under root as for checkSymlink.
+func checkSymlinks(root string) error {
+	return filepath.Walk(root, func(p string, fi os.FileInfo, err error) error {
+		if err != nil || fi.Mode()&os.ModeSymlink == 0 {
+			return err
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		linkname, err := os.Readlink(p)
+		if err != nil {
+			return err
+		}
+		return errors.Wrap(checkSymlink(root, filepath.ToSlash(rel), linkname), filepath.ToSlash(rel))
+	})
+}
+
+// removeExisting removes the file or empty directory at target, if any, so
+// that it can be replaced without following a symbolic link.
+func removeExisting(target string) error {
+	if err := os.Remove(target); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// applyQuiltSeries applies the patches listed in debian/patches/series under
+// dir, if present. Patches are applied with -p1 unless the series file gives
+// a -p option.
+func applyQuiltSeries(dir string) error {
+	series, err := securePath(dir, "debian/patches/series")
+	if err != nil {
+		return err
+	}
+	fi, err := os.Lstat(series)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if !fi.Mode().IsRegular() {
+		return errors.Wrap(ErrUnsafePath, "debian/patches/series is not a regular file")
+	}
+	b, err := ioutil.ReadFile(series)
+	if err != nil {
+		return err
+	}
+	for _, line := range strings.Split(string(b), "\n") {
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		strip := 1
+		for _, opt := range fields[1:] {
+			if !strings.HasPrefix(opt, "-p") {
+				return errors.Errorf("debian/patches/series: unsupported option %s for %s", opt, fields[0])
+			}
+			if strip, err = strconv.Atoi(opt[2:]); err != nil {
+				return errors.Errorf("debian/patches/series: invalid option %s for %s", opt, fields[0])
+			}
+		}
+		if err := applyPatchFile(dir, "debian/patches/"+fields[0], strip); err != nil {
+			return errors.Wrapf(err, "patch %s", fields[0])
+		}
+	}
+	return nil
+}
+
+// applyPatchFile applies the patch at name within dir.
+func applyPatchFile(dir, name string, strip int) error {
+	filename, err := securePath(dir, name)
+	if err != nil {
+		return err
+	}
+	fi, err := os.Lstat(filename)
+	if err != nil {
+		return err
+	}
+	if !fi.Mode().IsRegular() {
+		return errors.Wrapf(ErrUnsafePath, "patch %s is not a regular file", name)
+	}
+	f, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return applyPatch(dir, f, strip)
+}
+
+// applyCompressedPatch applies the gzip compressed diff of a 1.0 source
+// package to dir.
+func applyCompressedPatch(filename, dir string) error {
+	r, c, err := openCompressed(filename)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	return errors.Wrap(applyPatch(dir, r, 1), filepath.Base(filename))
+}
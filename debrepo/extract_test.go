@@ -0,0 +1,285 @@
+package debrepo
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+// testTarEntry is an entry of a tarball created by writeTestTarball. Entries
+// with a Linkname are symbolic links and entries ending in "/" directories.
+type testTarEntry struct {
+	Name     string
+	Contents string
+	Linkname string
+}
+
+func writeTestTarball(t *testing.T, filename string, entries []testTarEntry) {
+	buf := &bytes.Buffer{}
+	gw := gzip.NewWriter(buf)
+	tw := tar.NewWriter(gw)
+	for _, e := range entries {
+		h := &tar.Header{Name: e.Name, Mode: 0644, Size: int64(len(e.Contents)), Typeflag: tar.TypeReg}
+		switch {
+		case len(e.Linkname) != 0:
+			h.Typeflag, h.Linkname, h.Size = tar.TypeSymlink, e.Linkname, 0
+		case strings.HasSuffix(e.Name, "/"):
+			h.Typeflag, h.Mode = tar.TypeDir, 0755
+		}
+		if err := tw.WriteHeader(h); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(e.Contents)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filename, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func writeTestGzip(t *testing.T, filename, contents string) {
+	buf := &bytes.Buffer{}
+	gw := gzip.NewWriter(buf)
+	gw.Write([]byte(contents))
+	gw.Close()
+	if err := ioutil.WriteFile(filename, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// writeTestDsc writes a .dsc file for the files in dir with the given format
+// and returns its path.
+func writeTestDsc(t *testing.T, dir, format string, files ...string) string {
+	dsc := fmt.Sprintf("Format: %s\nSource: hello\nVersion: 2.10-1\nFiles:\n", format)
+	for _, name := range files {
+		b, err := ioutil.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		sum := md5.Sum(b)
+		dsc += fmt.Sprintf(" %s %d %s\n", hex.EncodeToString(sum[:]), len(b), name)
+	}
+	dscPath := filepath.Join(dir, "hello_2.10-1.dsc")
+	if err := ioutil.WriteFile(dscPath, []byte(dsc), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return dscPath
+}
+
+func testReadTree(t *testing.T, dir string) map[string]string {
+	tree := make(map[string]string)
+	filepath.Walk(dir, func(p string, fi os.FileInfo, err error) error {
+		if err != nil {
+			t.Fatal(err)
+		}
+		rel, _ := filepath.Rel(dir, p)
+		switch {
+		case fi.Mode()&os.ModeSymlink != 0:
+			target, _ := os.Readlink(p)
+			tree[filepath.ToSlash(rel)] = "-> " + target
+		case fi.Mode().IsRegular():
+			b, _ := ioutil.ReadFile(p)
+			tree[filepath.ToSlash(rel)] = string(b)
+		}
+		return nil
+	})
+	return tree
+}
+
+func testTempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "debrepo")
+	if err != nil {
+		t.Fatalf("unexpected error creating temp dir: %v", err)
+	}
+	return dir
+}
+
+func TestExtractSource_Quilt(t *testing.T) {
+	dir := testTempDir(t)
+	defer os.RemoveAll(dir)
+	writeTestTarball(t, filepath.Join(dir, "hello_2.10.orig.tar.gz"), []testTarEntry{
+		{Name: "hello-2.10/"},
+		{Name: "hello-2.10/hello.c", Contents: "int main() {\n\treturn 1;\n}\n"},
+		{Name: "hello-2.10/debian/upstream-packaging", Contents: "removed\n"},
+		{Name: "hello-2.10/link", Linkname: "hello.c"},
+	})
+	writeTestTarball(t, filepath.Join(dir, "hello_2.10.orig-docs.tar.gz"), []testTarEntry{
+		{Name: "docs-2.10/manual.txt", Contents: "manual\n"},
+	})
+	writeTestTarball(t, filepath.Join(dir, "hello_2.10-1.debian.tar.gz"), []testTarEntry{
+		{Name: "debian/control", Contents: "Source: hello\n"},
+		{Name: "debian/patches/series", Contents: "# comment\nfix-return.patch\n\nadd-file.patch -p0\n"},
+		{Name: "debian/patches/fix-return.patch", Contents: "--- a/hello.c\n+++ b/hello.c\n@@ -1,3 +1,3 @@\n int main() {\n-\treturn 1;\n+\treturn 0;\n }\n"},
+		{Name: "debian/patches/add-file.patch", Contents: "--- /dev/null\n+++ docs/NEWS\n@@ -0,0 +1 @@\n+news\n"},
+	})
+	dscPath := writeTestDsc(t, dir, "3.0 (quilt)", "hello_2.10.orig.tar.gz", "hello_2.10.orig-docs.tar.gz", "hello_2.10-1.debian.tar.gz")
+
+	out := filepath.Join(dir, "hello-2.10")
+	if err := ExtractSource(dscPath, out); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := map[string]string{
+		"hello.c":                         "int main() {\n\treturn 0;\n}\n",
+		"link":                            "-> hello.c",
+		"docs/manual.txt":                 "manual\n",
+		"docs/NEWS":                       "news\n",
+		"debian/control":                  "Source: hello\n",
+		"debian/patches/series":           "# comment\nfix-return.patch\n\nadd-file.patch -p0\n",
+		"debian/patches/fix-return.patch": "--- a/hello.c\n+++ b/hello.c\n@@ -1,3 +1,3 @@\n int main() {\n-\treturn 1;\n+\treturn 0;\n }\n",
+		"debian/patches/add-file.patch":   "--- /dev/null\n+++ docs/NEWS\n@@ -0,0 +1 @@\n+news\n",
+	}
+	if actual := testReadTree(t, out); fmt.Sprint(expected) != fmt.Sprint(actual) {
+		t.Fatalf("\nexpected=%q\nactual=%q", expected, actual)
+	}
+	if err := ExtractSource(dscPath, out); err == nil {
+		t.Fatal("expected error when extraction directory exists")
+	}
+}
+
+func TestExtractSource_Native(t *testing.T) {
+	dir := testTempDir(t)
+	defer os.RemoveAll(dir)
+	writeTestTarball(t, filepath.Join(dir, "hello_2.10.tar.gz"), []testTarEntry{
+		{Name: "hello-2.10/hello.c", Contents: "hello\n"},
+		{Name: "hello-2.10/debian/rules", Contents: "rules\n"},
+	})
+	dscPath := writeTestDsc(t, dir, "3.0 (native)", "hello_2.10.tar.gz")
+	out := filepath.Join(dir, "out")
+	if err := ExtractSource(dscPath, out); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := map[string]string{"hello.c": "hello\n", "debian/rules": "rules\n"}
+	if actual := testReadTree(t, out); fmt.Sprint(expected) != fmt.Sprint(actual) {
+		t.Fatalf("\nexpected=%q\nactual=%q", expected, actual)
+	}
+}
+
+func TestExtractSource_Version1Diff(t *testing.T) {
+	dir := testTempDir(t)
+	defer os.RemoveAll(dir)
+	writeTestTarball(t, filepath.Join(dir, "hello_2.10.orig.tar.gz"), []testTarEntry{
+		{Name: "hello-2.10.orig/hello.c", Contents: "a\nb\n"},
+	})
+	writeTestGzip(t, filepath.Join(dir, "hello_2.10-1.diff.gz"), `--- hello-2.10.orig/hello.c
++++ hello-2.10/hello.c
+@@ -1,2 +1,2 @@
+ a
+-b
++c
+--- hello-2.10.orig/debian/rules
++++ hello-2.10/debian/rules
+@@ -0,0 +1,2 @@
++#!/usr/bin/make -f
++include /usr/share/cdbs/1/rules/debhelper.mk
+`)
+	dscPath := writeTestDsc(t, dir, "1.0", "hello_2.10.orig.tar.gz", "hello_2.10-1.diff.gz")
+	out := filepath.Join(dir, "out")
+	if err := ExtractSource(dscPath, out); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	tree := testReadTree(t, out)
+	if expected, actual := "a\nc\n", tree["hello.c"]; expected != actual {
+		t.Fatalf("hello.c: expected=%q actual=%q", expected, actual)
+	}
+	fi, err := os.Stat(filepath.Join(out, "debian", "rules"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if expected, actual := os.FileMode(0755), fi.Mode().Perm(); expected != actual {
+		t.Fatalf("debian/rules mode: expected=%v actual=%v", expected, actual)
+	}
+}
+
+func TestExtractSource_UnsafePaths_ReturnsErrUnsafePath(t *testing.T) {
+	tests := []struct {
+		entries []testTarEntry
+		patch   string
+	}{
+		{entries: []testTarEntry{{Name: "../evil", Contents: "x"}}},
+		{entries: []testTarEntry{{Name: "/tmp/evil", Contents: "x"}}},
+		{entries: []testTarEntry{{Name: "debian/a/../../../evil", Contents: "x"}}},
+		{entries: []testTarEntry{{Name: "debian/link", Linkname: "/etc/passwd"}}},
+		{entries: []testTarEntry{{Name: "debian/link", Linkname: "../../etc"}}},
+		{entries: []testTarEntry{{Name: "debian/link", Linkname: ".."}, {Name: "debian/link/evil", Contents: "x"}}},
+		{entries: []testTarEntry{{Name: "debian/a/"}, {Name: "debian/a/b", Linkname: "../.."}, {Name: "debian/x", Linkname: "a/b"}, {Name: "debian/y", Linkname: "x/.."}}},
+		{entries: []testTarEntry{{Name: "debian/z", Linkname: "q/../../.."}, {Name: "debian/q/"}}},
+		{entries: []testTarEntry{{Name: "debian/q/"}, {Name: "debian/z", Linkname: "q/../.."}, {Name: "debian/q", Linkname: ".."}}},
+		{entries: []testTarEntry{{Name: "debian/loop", Linkname: "loop/x"}}},
+		{entries: []testTarEntry{{Name: "hello.c", Contents: "replaced\n"}}},
+		{entries: []testTarEntry{{Name: "debian/link", Linkname: "../hello.c"}}, patch: "--- a/debian/link\n+++ b/debian/link\n@@ -0,0 +1 @@\n+x\n"},
+		{patch: "--- a/../evil\n+++ b/../evil\n@@ -0,0 +1 @@\n+x\n"},
+	}
+	for i, test := range tests {
+		dir := testTempDir(t)
+		writeTestTarball(t, filepath.Join(dir, "hello_2.10.orig.tar.gz"), []testTarEntry{
+			{Name: "hello-2.10/hello.c", Contents: "hello\n"},
+		})
+		entries := test.entries
+		if len(test.patch) != 0 {
+			entries = append(entries,
+				testTarEntry{Name: "debian/patches/series", Contents: "unsafe.patch\n"},
+				testTarEntry{Name: "debian/patches/unsafe.patch", Contents: test.patch})
+		}
+		writeTestTarball(t, filepath.Join(dir, "hello_2.10-1.debian.tar.gz"), entries)
+		dscPath := writeTestDsc(t, dir, "3.0 (quilt)", "hello_2.10.orig.tar.gz", "hello_2.10-1.debian.tar.gz")
+		out := filepath.Join(dir, "out")
+		err := ExtractSource(dscPath, out)
+		_, statErr := os.Lstat(out)
+		os.RemoveAll(dir)
+		if errors.Cause(err) != ErrUnsafePath {
+			t.Fatalf("test(%v): expected ErrUnsafePath, got: %v", i, err)
+		}
+		if !os.IsNotExist(statErr) {
+			t.Fatalf("test(%v): expected extraction directory to be removed", i)
+		}
+	}
+}
+
+func TestExtractSource_TamperedTarball_ReturnsChecksumError(t *testing.T) {
+	dir := testTempDir(t)
+	defer os.RemoveAll(dir)
+	tarball := filepath.Join(dir, "hello_2.10.tar.gz")
+	writeTestTarball(t, tarball, []testTarEntry{{Name: "hello-2.10/hello.c", Contents: "hello\n"}})
+	dscPath := writeTestDsc(t, dir, "3.0 (native)", "hello_2.10.tar.gz")
+	b, err := ioutil.ReadFile(tarball)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		contents []byte
+		err      error
+	}{
+		{append([]byte{b[0] ^ 0xff}, b[1:]...), &ChecksumError{}},
+		{append(b, 0), &SizeError{}},
+	}
+	for i, test := range tests {
+		if err := ioutil.WriteFile(tarball, test.contents, 0644); err != nil {
+			t.Fatal(err)
+		}
+		out := filepath.Join(dir, "out")
+		err := ExtractSource(dscPath, out)
+		if expected, actual := fmt.Sprintf("%T", test.err), fmt.Sprintf("%T", err); expected != actual {
+			t.Fatalf("test(%v): expected=%v actual=%v (%v)", i, expected, actual, err)
+		}
+		if _, err := os.Lstat(out); !os.IsNotExist(err) {
+			t.Fatalf("test(%v): expected extraction directory not to be created", i)
+		}
+	}
+}
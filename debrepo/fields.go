@@ -3,28 +3,284 @@ package debrepo
 import (
 	"bufio"
 	"bytes"
+	"fmt"
 	"io"
-	"net/textproto"
+	"strings"
+
+	"github.com/pkg/errors"
 )
 
-// Fields is a map of keys and values parsed from an index file.
-type Fields textproto.MIMEHeader
-
-// ReadFields returns a Fields containing the values parsed from the provided
-// bytes. Field names are set by textproto.CanonicalMIMEHeaderKey().
-//	From textproto.CanonicalMIMEHeaderKey:
-//	The canonicalization converts the first letter and any letter following a
-//	hyphen to upper case; the rest are converted to lowercase. For example, the
-//	canonical key for "accept-encoding" is "Accept-Encoding". MIME header keys
-//	are assumed to be ASCII only. If s contains a space or invalid header field
-//	bytes, it is returned without modifications.
+// Field is a single field of a deb822 paragraph, as found in control files and
+// index files such as Release and Packages.
+//
+// The Value of a field spanning several lines holds the text of its first
+// line followed by each continuation line, separated by newlines. The leading
+// space of continuation lines is removed and the " ." marker is replaced by an
+// empty line.
+type Field struct {
+	Name  string
+	Value string
+}
+
+// Fields is a deb822 paragraph. Fields are kept in the order they were read
+// and field names keep their original casing. Lookups by name are
+// case-insensitive.
+type Fields []Field
+
+// ParseError is returned when a deb822 paragraph cannot be parsed. Line is the
+// 1-based line number of the offending line.
+type ParseError struct {
+	Line int
+	Err  error
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("line %d: %v", e.Line, e.Err)
+}
+
+// ReadFields returns the fields of the first paragraph in b. An empty
+// Fields is returned if b contains no paragraphs. See ParagraphReader.
 func ReadFields(b []byte) (Fields, error) {
-	buf := bytes.NewBuffer(b)
-	r := bufio.NewReader(buf)
-	rr := textproto.NewReader(r)
-	fields, err := rr.ReadMIMEHeader()
-	if err != nil && err != io.EOF {
-		return nil, err
-	}
-	return Fields(fields), nil
+	fields, err := NewParagraphReader(bytes.NewReader(b)).Read()
+	if err == io.EOF {
+		return Fields{}, nil
+	}
+	return fields, err
+}
+
+// Lookup returns the value of the field name and whether it is present. Names
+// are compared case-insensitively.
+func (f Fields) Lookup(name string) (string, bool) {
+	for _, field := range f {
+		if strings.EqualFold(field.Name, name) {
+			return field.Value, true
+		}
+	}
+	return "", false
+}
+
+// Get returns the value of the field name. It returns an empty string if the
+// field is not present. Names are compared case-insensitively.
+func (f Fields) Get(name string) string {
+	v, _ := f.Lookup(name)
+	return v
+}
+
+// Folded returns the value of the folded field name, such as Depends, with
+// its lines joined by single spaces. Line breaks are not significant in folded
+// fields.
+func (f Fields) Folded(name string) string {
+	var lines []string
+	for _, line := range strings.Split(f.Get(name), "\n") {
+		if line = strings.TrimSpace(line); len(line) != 0 {
+			lines = append(lines, line)
+		}
+	}
+	return strings.Join(lines, " ")
+}
+
+// Names returns the names of the fields in order.
+func (f Fields) Names() []string {
+	names := make([]string, len(f))
+	for i, field := range f {
+		names[i] = field.Name
+	}
+	return names
+}
+
+// ParagraphReader reads deb822 paragraphs. Paragraphs are separated by one or
+// more blank lines and lines starting with '#' are ignored as comments.
+type ParagraphReader struct {
+	r     *bufio.Reader
+	line  int
+	start int
+}
+
+// NewParagraphReader returns a ParagraphReader which reads from r.
+func NewParagraphReader(r io.Reader) *ParagraphReader {
+	return &ParagraphReader{r: bufio.NewReader(r)}
+}
+
+// Line returns the line number on which the paragraph last returned by Read
+// starts.
+func (pr *ParagraphReader) Line() int {
+	return pr.start
+}
+
+// Read returns the next paragraph. It returns io.EOF when no paragraphs
+// remain. Syntax errors are returned as a *ParseError.
+func (pr *ParagraphReader) Read() (Fields, error) {
+	var fields Fields
+	for {
+		line, err := pr.r.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		if len(line) == 0 && err == io.EOF {
+			if len(fields) != 0 {
+				return fields, nil
+			}
+			return nil, io.EOF
+		}
+		pr.line++
+		line = strings.TrimRight(line, "\r\n")
+		switch {
+		case strings.HasPrefix(line, "#"):
+		case len(strings.TrimSpace(line)) == 0:
+			if len(fields) != 0 {
+				return fields, nil
+			}
+		case line[0] == ' ' || line[0] == '\t':
+			if len(fields) == 0 {
+				return nil, &ParseError{Line: pr.line, Err: errors.New("continuation line without field")}
+			}
+			value := line[1:]
+			if value == "." {
+				value = ""
+			}
+			fields[len(fields)-1].Value += "\n" + value
+		default:
+			i := strings.IndexByte(line, ':')
+			if i <= 0 {
+				return nil, &ParseError{Line: pr.line, Err: errors.Errorf("invalid field %q", line)}
+			}
+			name := line[:i]
+			if strings.ContainsAny(name, " \t") {
+				return nil, &ParseError{Line: pr.line, Err: errors.Errorf("invalid field %q", line)}
+			}
+			if _, ok := fields.Lookup(name); ok {
+				return nil, &ParseError{Line: pr.line, Err: errors.Errorf("duplicate field %q", name)}
+			}
+			if len(fields) == 0 {
+				pr.start = pr.line
+			}
+			fields = append(fields, Field{Name: name, Value: strings.TrimSpace(line[i+1:])})
+		}
+		if err == io.EOF {
+			if len(fields) != 0 {
+				return fields, nil
+			}
+			return nil, io.EOF
+		}
+	}
+}
+
+// Set sets the value of the field name, replacing the value of an existing
+// field with the same name compared case-insensitively. New fields are added
+// to the end.
+func (f *Fields) Set(name, value string) {
+	for i, field := range *f {
+		if strings.EqualFold(field.Name, name) {
+			(*f)[i].Value = value
+			return
+		}
+	}
+	*f = append(*f, Field{Name: name, Value: value})
+}
+
+// Del removes the field name.
+func (f *Fields) Del(name string) {
+	for i, field := range *f {
+		if strings.EqualFold(field.Name, name) {
+			*f = append((*f)[:i], (*f)[i+1:]...)
+			return
+		}
+	}
+}
+
+// WriteFields writes fields to w as a single deb822 paragraph. See
+// ParagraphWriter.
+func WriteFields(w io.Writer, fields Fields) error {
+	return NewParagraphWriter(w).Write(fields)
+}
+
+// ParagraphWriter writes deb822 paragraphs. Paragraphs are separated by blank
+// lines. Fields are written in order; each line of a multiline value after
+// the first is written as a continuation line and empty lines are written as
+// " .". Output read by ParagraphReader and written again is unchanged.
+type ParagraphWriter struct {
+	w       *bufio.Writer
+	written bool
+}
+
+// NewParagraphWriter returns a ParagraphWriter which writes to w.
+func NewParagraphWriter(w io.Writer) *ParagraphWriter {
+	return &ParagraphWriter{w: bufio.NewWriter(w)}
+}
+
+// Write writes fields as a paragraph. An error is returned if a field name is
+// invalid or a value cannot be represented in deb822.
+func (pw *ParagraphWriter) Write(fields Fields) error {
+	if len(fields) == 0 {
+		return errors.New("empty paragraph")
+	}
+	for _, field := range fields {
+		if err := validateField(field); err != nil {
+			return err
+		}
+	}
+	if pw.written {
+		pw.w.WriteByte('\n')
+	}
+	for _, field := range fields {
+		lines := strings.Split(field.Value, "\n")
+		pw.w.WriteString(field.Name)
+		pw.w.WriteByte(':')
+		if len(lines[0]) != 0 {
+			pw.w.WriteByte(' ')
+			pw.w.WriteString(lines[0])
+		}
+		pw.w.WriteByte('\n')
+		for _, line := range lines[1:] {
+			if len(line) == 0 {
+				line = "."
+			}
+			pw.w.WriteByte(' ')
+			pw.w.WriteString(line)
+			pw.w.WriteByte('\n')
+		}
+	}
+	pw.written = true
+	return pw.w.Flush()
+}
+
+func validateField(field Field) error {
+	if len(field.Name) == 0 || strings.ContainsAny(field.Name, ": \t\n") || field.Name[0] == '#' || field.Name[0] == '-' {
+		return errors.Errorf("invalid field name %q", field.Name)
+	}
+	lines := strings.Split(field.Value, "\n")
+	if first := lines[0]; first != strings.TrimSpace(first) {
+		return errors.Errorf("field %s: leading or trailing whitespace on first line", field.Name)
+	}
+	for _, line := range lines[1:] {
+		if line == "." || (len(line) != 0 && len(strings.TrimSpace(line)) == 0) {
+			return errors.Errorf("field %s: line cannot be represented: %q", field.Name, line)
+		}
+	}
+	return nil
+}
+
+// parseAptBool parses a boolean as apt does. The values "yes", "true", "with",
+// "on", "enable" and "1" are true and "no", "false", "without", "off",
+// "disable" and "0" are false, ignoring case.
+func parseAptBool(value string) (bool, error) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "yes", "true", "with", "on", "enable", "1":
+		return true, nil
+	case "no", "false", "without", "off", "disable", "0":
+		return false, nil
+	}
+	return false, errors.Errorf("invalid boolean %q", value)
+}
+
+// fieldLine returns the 1-based line number of the field name in the first
+// paragraph of b. It returns 0 if the field is not found.
+func fieldLine(b []byte, name string) int {
+	for i, line := range strings.Split(string(b), "\n") {
+		if j := strings.IndexByte(line, ':'); j > 0 && strings.EqualFold(strings.TrimSpace(line[:j]), name) &&
+			line[0] != ' ' && line[0] != '\t' {
+			return i + 1
+		}
+	}
+	return 0
 }
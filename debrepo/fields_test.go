@@ -1,6 +1,9 @@
 package debrepo
 
 import (
+	"bytes"
+	"io"
+	"io/ioutil"
 	"reflect"
 	"testing"
 )
@@ -16,9 +19,9 @@ MD5Sum:
  974c021c888f99cdfe9562e5f952484a  1194721 contrib/Contents-amd64
  450dd45dc5f77c017ef8dd3dd7bc0f8c    88515 contrib/Contents-amd64.gz`,
 		expected: Fields{
-			"Origin":     {"Debian"},
-			"Components": {"main contrib non-free"},
-			"Md5sum":     {"974c021c888f99cdfe9562e5f952484a  1194721 contrib/Contents-amd64 450dd45dc5f77c017ef8dd3dd7bc0f8c    88515 contrib/Contents-amd64.gz"},
+			{"Origin", "Debian"},
+			{"Components", "main contrib non-free"},
+			{"MD5Sum", "\n974c021c888f99cdfe9562e5f952484a  1194721 contrib/Contents-amd64\n450dd45dc5f77c017ef8dd3dd7bc0f8c    88515 contrib/Contents-amd64.gz"},
 		},
 	},
 	{
@@ -26,10 +29,27 @@ MD5Sum:
 Tag: implemented-in::c, interface::daemon, network::server, network::service,
  protocol::http, role::program, use::proxying`,
 		expected: Fields{
-			"Description-Md5": {"fcb68fdad0dca137e47a44b011e92ee4"},
-			"Tag":             {"implemented-in::c, interface::daemon, network::server, network::service, protocol::http, role::program, use::proxying"},
+			{"Description-md5", "fcb68fdad0dca137e47a44b011e92ee4"},
+			{"Tag", "implemented-in::c, interface::daemon, network::server, network::service,\nprotocol::http, role::program, use::proxying"},
 		},
 	},
+	{
+		input: `# comment
+Description: summary
+ first paragraph
+ .
+  indented line
+Homepage: http://example.com/
+`,
+		expected: Fields{
+			{"Description", "summary\nfirst paragraph\n\n indented line"},
+			{"Homepage", "http://example.com/"},
+		},
+	},
+	{
+		input:    "\n\n",
+		expected: Fields{},
+	},
 }
 
 func TestReadFields(t *testing.T) {
@@ -39,7 +59,166 @@ func TestReadFields(t *testing.T) {
 			t.Fatalf("test(%v): unexpected error parsing fields: %v", i, err)
 		}
 		if expected := test.expected; !reflect.DeepEqual(expected, actual) {
-			t.Fatalf("test(%v): expected != actual", i)
+			t.Fatalf("test(%v): expected=%q actual=%q", i, expected, actual)
+		}
+	}
+}
+
+func TestFields_Lookup_CaseInsensitive(t *testing.T) {
+	fields := Fields{{"MD5Sum", "a"}, {"Tag", "b,\nc"}}
+	tests := []struct {
+		name   string
+		value  string
+		folded string
+		ok     bool
+	}{
+		{"MD5Sum", "a", "a", true},
+		{"md5sum", "a", "a", true},
+		{"TAG", "b,\nc", "b, c", true},
+		{"SHA256", "", "", false},
+	}
+	for i, test := range tests {
+		value, ok := fields.Lookup(test.name)
+		if expected, actual := test.ok, ok; expected != actual {
+			t.Fatalf("test(%v): ok: expected=%v actual=%v", i, expected, actual)
+		}
+		if expected, actual := test.value, value; expected != actual {
+			t.Fatalf("test(%v): expected=%q actual=%q", i, expected, actual)
+		}
+		if expected, actual := test.folded, fields.Folded(test.name); expected != actual {
+			t.Fatalf("test(%v): folded: expected=%q actual=%q", i, expected, actual)
+		}
+	}
+}
+
+func TestParagraphReader_MultipleParagraphs(t *testing.T) {
+	input := "# header comment\n\nPackage: a\nVersion: 1\n\n\n# comment\nPackage: b\n# inline comment\nVersion: 2\n"
+	pr := NewParagraphReader(bytes.NewBufferString(input))
+	expected := []struct {
+		fields Fields
+		line   int
+	}{
+		{Fields{{"Package", "a"}, {"Version", "1"}}, 3},
+		{Fields{{"Package", "b"}, {"Version", "2"}}, 8},
+	}
+	for i, expected := range expected {
+		actual, err := pr.Read()
+		if err != nil {
+			t.Fatalf("test(%v): unexpected error: %v", i, err)
+		}
+		if !reflect.DeepEqual(expected.fields, actual) {
+			t.Fatalf("test(%v): expected=%q actual=%q", i, expected.fields, actual)
+		}
+		if expected, actual := expected.line, pr.Line(); expected != actual {
+			t.Fatalf("test(%v): line: expected=%v actual=%v", i, expected, actual)
 		}
 	}
+	if _, err := pr.Read(); err != io.EOF {
+		t.Fatalf("expected io.EOF, got: %v", err)
+	}
+}
+
+var paragraphReaderErrorTests = []struct {
+	input string
+	line  int
+}{
+	{" continuation\n", 1},
+	{"Package: a\n\n continuation\n", 3},
+	{"Package: a\nbad line\n", 2},
+	{"Package: a\n: no name\n", 2},
+	{"Package: a\nbad name: value\n", 2},
+	{"Package: a\nVersion: 1\npackage: b\n", 3},
+}
+
+func TestParagraphReader_InvalidInput_ReturnsLineNumber(t *testing.T) {
+	for i, test := range paragraphReaderErrorTests {
+		pr := NewParagraphReader(bytes.NewBufferString(test.input))
+		var err error
+		for err == nil {
+			_, err = pr.Read()
+		}
+		parseErr, ok := err.(*ParseError)
+		if !ok {
+			t.Fatalf("test(%v): expected *ParseError, got: %v", i, err)
+		}
+		if expected, actual := test.line, parseErr.Line; expected != actual {
+			t.Fatalf("test(%v): line: expected=%v actual=%v", i, expected, actual)
+		}
+	}
+}
+
+func TestWriteFields_TestDataRelease_RoundTrips(t *testing.T) {
+	expected, err := ioutil.ReadFile("testdata/test_repo/ubuntu/dists/xenial/Release")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fields, err := ReadFields(expected)
+	if err != nil {
+		t.Fatalf("unexpected error reading fields: %v", err)
+	}
+	buf := &bytes.Buffer{}
+	if err := WriteFields(buf, fields); err != nil {
+		t.Fatalf("unexpected error writing fields: %v", err)
+	}
+	if actual := buf.Bytes(); !bytes.Equal(expected, actual) {
+		t.Fatal("written Release file does not match original")
+	}
+}
+
+func TestParagraphWriter_MultipleParagraphs_RoundTrips(t *testing.T) {
+	paragraphs := []Fields{
+		{{"Package", "a"}, {"Description", "summary\nfirst paragraph\n\n indented line"}},
+		{{"Package", "b"}, {"Depends", "c,\nd"}, {"Empty", ""}},
+	}
+	expected := "Package: a\nDescription: summary\n first paragraph\n .\n  indented line\n\n" +
+		"Package: b\nDepends: c,\n d\nEmpty:\n"
+	buf := &bytes.Buffer{}
+	pw := NewParagraphWriter(buf)
+	for i, fields := range paragraphs {
+		if err := pw.Write(fields); err != nil {
+			t.Fatalf("test(%v): unexpected error: %v", i, err)
+		}
+	}
+	if actual := buf.String(); expected != actual {
+		t.Fatalf("expected=%q actual=%q", expected, actual)
+	}
+	pr := NewParagraphReader(buf)
+	for i, expected := range paragraphs {
+		actual, err := pr.Read()
+		if err != nil {
+			t.Fatalf("test(%v): unexpected error: %v", i, err)
+		}
+		if !reflect.DeepEqual(expected, actual) {
+			t.Fatalf("test(%v): expected=%q actual=%q", i, expected, actual)
+		}
+	}
+}
+
+func TestWriteFields_InvalidFields_ReturnsError(t *testing.T) {
+	tests := []Fields{
+		{},
+		{{"", "value"}},
+		{{"Bad Name", "value"}},
+		{{"Bad:Name", "value"}},
+		{{"#Comment", "value"}},
+		{{"Name", " leading space"}},
+		{{"Name", "first\n."}},
+		{{"Name", "first\n  "}},
+	}
+	for i, test := range tests {
+		if err := WriteFields(ioutil.Discard, test); err == nil {
+			t.Fatalf("test(%v): expected error writing %q", i, test)
+		}
+	}
+}
+
+func TestFields_SetAndDel(t *testing.T) {
+	fields := Fields{{"Package", "a"}, {"Version", "1"}}
+	fields.Set("version", "2")
+	fields.Set("Architecture", "all")
+	fields.Del("PACKAGE")
+	expected := Fields{{"Version", "2"}, {"Architecture", "all"}}
+	if !reflect.DeepEqual(expected, fields) {
+		t.Fatalf("expected=%q actual=%q", expected, fields)
+	}
 }
@@ -1,6 +1,7 @@
 package debrepo
 
 import (
+	"compress/gzip"
 	"crypto"
 	"errors"
 	"fmt"
@@ -10,51 +11,160 @@ import (
 	"reflect"
 	"sync"
 
+	"github.com/ulikunitz/xz"
 	"golang.org/x/net/context"
 	"golang.org/x/net/context/ctxhttp"
 )
 
 // FileMeta is metadata associated with a file stored on a package repository.
+// Hashes holds every checksum listed for the file. HashSum and Hash hold the
+// strongest of them, which may be MD5 or SHA1 if nothing stronger is listed;
+// use StrongestHash to select a checksum suitable for verification.
 type FileMeta struct {
 	HashSum []byte
 	Hash    crypto.Hash
 	Size    int64
+	Hashes  map[crypto.Hash][]byte
+}
+
+// hashStrength lists the hash functions used in Release file tables from
+// strongest to weakest.
+var hashStrength = [...]crypto.Hash{
+	crypto.SHA512,
+	crypto.SHA256,
+	crypto.SHA1,
+	crypto.MD5,
+}
+
+// isWeakHash returns true for hash functions which must not be relied on to
+// verify files unless explicitly allowed.
+func isWeakHash(h crypto.Hash) bool {
+	return h == crypto.MD5 || h == crypto.SHA1
+}
+
+// StrongestHash returns the strongest checksum listed for the file. MD5 and
+// SHA1 checksums are only returned if allowWeak is true. It returns false if
+// no acceptable checksum is listed.
+func (m FileMeta) StrongestHash(allowWeak bool) (crypto.Hash, []byte, bool) {
+	hashes := m.Hashes
+	if len(hashes) == 0 && len(m.HashSum) != 0 {
+		hashes = map[crypto.Hash][]byte{m.Hash: m.HashSum}
+	}
+	for _, h := range hashStrength {
+		if sum, ok := hashes[h]; ok && (allowWeak || !isWeakHash(h)) {
+			return h, sum, true
+		}
+	}
+	return 0, nil, false
+}
+
+// compression is a compression format used for index files on a package
+// repository.
+type compression int
+
+const (
+	compressionNone compression = iota
+	compressionGzip
+	compressionXZ
+)
+
+// compressions lists the supported compression formats in order of
+// preference.
+var compressions = [...]compression{
+	compressionXZ,
+	compressionGzip,
+	compressionNone,
+}
+
+// ext returns the file extension used for files in the compression format.
+func (c compression) ext() string {
+	switch c {
+	case compressionGzip:
+		return ".gz"
+	case compressionXZ:
+		return ".xz"
+	}
+	return ""
+}
+
+// newReader returns a Reader which decompresses the contents of r.
+func (c compression) newReader(r io.Reader) (io.Reader, error) {
+	switch c {
+	case compressionGzip:
+		return gzip.NewReader(r)
+	case compressionXZ:
+		return xz.NewReader(r)
+	}
+	return r, nil
 }
 
 // File is a file stored on a package repository.
 type File struct {
-	meta FileMeta
-	url  string
-	open bool
-	mu   sync.Mutex
-	rc   io.ReadCloser
-	hash hash.Hash
+	meta          FileMeta
+	url           string
+	compression   compression
+	allowWeakHash bool
+	byHashURL     string
+	open          bool
+	mu            sync.Mutex
+	rc            io.ReadCloser
+	hash          hash.Hash
+	hashSum       []byte
 }
 
 // Open returns a Reader with the contents of the file. Open must be followed
 // by a close to release resources. Reads update a running hash of the file
 // contents which can be checked by calling CheckHash. CheckHash should be
 // called after the entire contents of the file have been read to verify the
-// file matches the expected hash sum.
+// file matches the expected hash sum. The strongest checksum listed for the
+// file is used; MD5 and SHA1 are not used unless weak hashes were allowed.
+//
+// If the repository supports Acquire-By-Hash, the file is requested by its
+// checksum from the by-hash directory next to it, falling back to its
+// canonical URL if the by-hash copy is not found.
+//
+// If the file is compressed, the returned Reader decompresses its contents.
+// The hash is calculated over the compressed contents as they are listed in
+// the Release file.
 func (f *File) Open(ctx context.Context, client *http.Client) (io.Reader, error) {
 	f.mu.Lock()
 	defer f.mu.Unlock()
-	// TODO: Make sure hash type is set to a compatible hash type
 	if f.open {
 		return nil, errors.New("file already open")
 	}
-	resp, err := ctxhttp.Get(ctx, client, f.url)
+	hashType, hashSum, ok := f.meta.StrongestHash(f.allowWeakHash)
+	if !ok {
+		return nil, fmt.Errorf("no SHA256 or SHA512 checksum for file: %s", f.url)
+	}
+	url := f.url
+	if len(f.byHashURL) != 0 {
+		url = f.byHashURL
+	}
+	resp, err := ctxhttp.Get(ctx, client, url)
 	if err != nil {
 		return nil, err
 	}
+	if resp.StatusCode == http.StatusNotFound && url != f.url {
+		resp.Body.Close()
+		url = f.url
+		if resp, err = ctxhttp.Get(ctx, client, url); err != nil {
+			return nil, err
+		}
+	}
 	if resp.StatusCode != http.StatusOK {
 		resp.Body.Close()
-		return nil, fmt.Errorf("error requesting file: %v", err)
+		return nil, fmt.Errorf("error requesting file: %s: %s", url, resp.Status)
+	}
+	h := hashType.New()
+	r, err := f.compression.newReader(io.TeeReader(resp.Body, h))
+	if err != nil {
+		resp.Body.Close()
+		return nil, fmt.Errorf("error decompressing file: %s: %v", url, err)
 	}
 	f.rc = resp.Body
 	f.open = true
-	f.hash = f.meta.Hash.New()
-	r := io.TeeReader(resp.Body, f.hash)
+	f.hash = h
+	f.hashSum = hashSum
 	return r, nil
 }
 
@@ -79,13 +189,19 @@ func (f *File) CheckHash() error {
 	}
 	var hash []byte
 	hash = f.hash.Sum(hash)
-	if !reflect.DeepEqual(hash, f.meta.HashSum) {
+	if !reflect.DeepEqual(hash, f.hashSum) {
 		return errors.New("hash does not match")
 	}
 	return nil
 }
 
-// Size returns the file size.
+// Size returns the file size. For compressed files this is the size of the
+// compressed contents.
 func (f *File) Size() int64 {
 	return f.meta.Size
 }
+
+// URL returns the location of the file on the package repository.
+func (f *File) URL() string {
+	return f.url
+}
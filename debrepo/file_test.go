@@ -4,6 +4,7 @@ import (
 	"crypto"
 	"io"
 	"io/ioutil"
+	"reflect"
 	"testing"
 
 	"golang.org/x/net/context"
@@ -11,12 +12,17 @@ import (
 
 var (
 	matchingHash = FileMeta{
-		HashSum: decodeHexString("7b7877be9dd6ac0e6b8baffbc36ce09c"),
-		Hash:    crypto.MD5,
+		HashSum: decodeHexString("8d6ab57abf517d7712e4e4d23d762485af49f8140a83b221ea7282f82a51c795"),
+		Hash:    crypto.SHA256,
 		Size:    1557985,
 	}
 	nonMatchingHash = FileMeta{
-		HashSum: decodeHexString("000000be9dd6ac0e6b8baffbc36ce09c"),
+		HashSum: decodeHexString("0000b57abf517d7712e4e4d23d762485af49f8140a83b221ea7282f82a51c795"),
+		Hash:    crypto.SHA256,
+		Size:    1557985,
+	}
+	weakHash = FileMeta{
+		HashSum: decodeHexString("7b7877be9dd6ac0e6b8baffbc36ce09c"),
 		Hash:    crypto.MD5,
 		Size:    1557985,
 	}
@@ -52,6 +58,62 @@ func TestFileOpen_FileDoesNotMatchHash_Error(t *testing.T) {
 	}
 }
 
+func TestFileOpen_WeakHash_RequiresAllowWeakHash(t *testing.T) {
+	tr := NewTestRepository()
+	defer tr.Close()
+	file := newTestFile(tr, weakHash)
+	if _, err := file.Open(context.Background(), nil); err == nil {
+		file.Close()
+		t.Fatal("expected error opening file with only an MD5 checksum")
+	}
+	file.allowWeakHash = true
+	r, err := file.Open(context.Background(), nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer file.Close()
+	io.Copy(ioutil.Discard, r)
+	if err := file.CheckHash(); err != nil {
+		t.Fatalf("unexpected hash failure: %v", err)
+	}
+}
+
+func TestFileMetaStrongestHash(t *testing.T) {
+	sums := map[crypto.Hash][]byte{
+		crypto.MD5:    decodeHexString("7b7877be9dd6ac0e6b8baffbc36ce09c"),
+		crypto.SHA1:   decodeHexString("0e0ee5bd4f4a4ab4e6e4b8d6b4a66f2de3b02c1c"),
+		crypto.SHA256: decodeHexString("8d6ab57abf517d7712e4e4d23d762485af49f8140a83b221ea7282f82a51c795"),
+	}
+	tests := []struct {
+		hashes    []crypto.Hash
+		allowWeak bool
+		expected  crypto.Hash
+		ok        bool
+	}{
+		{[]crypto.Hash{crypto.MD5, crypto.SHA1, crypto.SHA256}, false, crypto.SHA256, true},
+		{[]crypto.Hash{crypto.MD5, crypto.SHA1}, false, 0, false},
+		{[]crypto.Hash{crypto.MD5, crypto.SHA1}, true, crypto.SHA1, true},
+		{[]crypto.Hash{crypto.MD5}, true, crypto.MD5, true},
+		{nil, true, 0, false},
+	}
+	for i, test := range tests {
+		meta := FileMeta{Hashes: make(map[crypto.Hash][]byte)}
+		for _, h := range test.hashes {
+			meta.Hashes[h] = sums[h]
+		}
+		hash, sum, ok := meta.StrongestHash(test.allowWeak)
+		if expected, actual := test.ok, ok; expected != actual {
+			t.Fatalf("test(%v): ok: expected=%v actual=%v", i, expected, actual)
+		}
+		if expected, actual := test.expected, hash; expected != actual {
+			t.Fatalf("test(%v): expected=%v actual=%v", i, expected, actual)
+		}
+		if ok && !reflect.DeepEqual(sums[hash], sum) {
+			t.Fatalf("test(%v): sum: expected=%x actual=%x", i, sums[hash], sum)
+		}
+	}
+}
+
 func newTestFile(tr *testRepository, meta FileMeta) *File {
 	return &File{
 		meta: meta,
@@ -0,0 +1,81 @@
+package debrepo
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// ErrReleaseExpired is returned when a Release file's Valid-Until date
+	// has passed.
+	ErrReleaseExpired = Error("release file expired")
+
+	// ErrReleaseTooOld is returned when a Release file's Date is older than
+	// the maximum age allowed by a FreshnessPolicy.
+	ErrReleaseTooOld = Error("release file too old")
+
+	// ErrReleaseInFuture is returned when a Release file's Date is further in
+	// the future than the clock skew allowed by a FreshnessPolicy.
+	ErrReleaseInFuture = Error("release file dated in the future")
+)
+
+// DefaultClockSkew is the clock skew tolerated for Release files dated in the
+// future when FreshnessPolicy.ClockSkew is zero.
+const DefaultClockSkew = 10 * time.Second
+
+// FreshnessPolicy controls how old a signed Release file may be. Checking
+// freshness prevents a mirror from replaying an old, validly signed Release
+// file to hold back updates.
+//
+// Release files whose Valid-Until date has passed are always rejected. If
+// MaxAge is non-zero, Release files whose Date is older than MaxAge are
+// rejected as well; a Release file without a Date is then rejected too.
+// Release files dated more than ClockSkew in the future are rejected. If
+// ClockSkew is zero DefaultClockSkew is used.
+//
+// If Now is nil, time.Now is used.
+type FreshnessPolicy struct {
+	MaxAge    time.Duration
+	ClockSkew time.Duration
+	Now       func() time.Time
+}
+
+// Check returns an error if info does not satisfy the policy. The returned
+// error's cause is ErrReleaseExpired, ErrReleaseTooOld or ErrReleaseInFuture.
+func (p FreshnessPolicy) Check(info *ReleaseInfo) error {
+	now := time.Now()
+	if p.Now != nil {
+		now = p.Now()
+	}
+	skew := p.ClockSkew
+	if skew == 0 {
+		skew = DefaultClockSkew
+	}
+	if !info.ValidUntil.IsZero() && now.After(info.ValidUntil) {
+		return errors.Wrapf(ErrReleaseExpired, "valid until %s", info.ValidUntil.Format(time.RFC1123))
+	}
+	if info.Date.IsZero() {
+		if p.MaxAge != 0 {
+			return errors.Wrap(ErrReleaseTooOld, "no Date field")
+		}
+		return nil
+	}
+	if info.Date.After(now.Add(skew)) {
+		return errors.Wrapf(ErrReleaseInFuture, "dated %s", info.Date.Format(time.RFC1123))
+	}
+	if p.MaxAge != 0 && now.Sub(info.Date) > p.MaxAge {
+		return errors.Wrapf(ErrReleaseTooOld, "dated %s", info.Date.Format(time.RFC1123))
+	}
+	return nil
+}
+
+// CheckFreshness returns an error if the Release file does not satisfy
+// policy. See FreshnessPolicy.
+func (r *Release) CheckFreshness(policy FreshnessPolicy) error {
+	info, err := r.ReadInfo()
+	if err != nil {
+		return err
+	}
+	return policy.Check(info)
+}
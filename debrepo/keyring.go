@@ -0,0 +1,185 @@
+package debrepo
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/armor"
+)
+
+// EntityKeyRing is a KeyRing holding a list of OpenPGP keys. It is returned by
+// KeyRingFromFile, KeyRingFromArmored and KeyRingFromDir.
+type EntityKeyRing struct {
+	Entities openpgp.EntityList
+}
+
+// KeyRing returns the keys as an openpgp.KeyRing.
+func (k *EntityKeyRing) KeyRing() openpgp.KeyRing {
+	return k.Entities
+}
+
+// KeyRingFromFile reads a keyring file containing binary or ASCII-armored
+// keys, such as /etc/apt/trusted.gpg. The format is detected from the file's
+// contents. An empty file results in an empty keyring.
+func KeyRingFromFile(filename string) (*EntityKeyRing, error) {
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	el, err := readKeyRing(b)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid keyring file: %s", filename)
+	}
+	return &EntityKeyRing{Entities: el}, nil
+}
+
+// KeyRingFromArmored reads one or more ASCII-armored public key blocks from r.
+func KeyRingFromArmored(r io.Reader) (*EntityKeyRing, error) {
+	el, err := readArmoredKeyRing(r)
+	if err != nil {
+		return nil, err
+	}
+	return &EntityKeyRing{Entities: el}, nil
+}
+
+// KeyRingFromDir reads every keyring file in dir, such as
+// /etc/apt/trusted.gpg.d, and merges their keys. As with apt, only files with
+// a ".gpg" (binary) or ".asc" (ASCII-armored) extension are read; other files
+// and subdirectories are ignored. Files are read in lexical order.
+func KeyRingFromDir(dir string) (*EntityKeyRing, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	keyring := &EntityKeyRing{}
+	for _, file := range files {
+		ext := filepath.Ext(file.Name())
+		if file.IsDir() || (ext != ".gpg" && ext != ".asc") {
+			continue
+		}
+		k, err := KeyRingFromFile(filepath.Join(dir, file.Name()))
+		if err != nil {
+			return nil, err
+		}
+		keyring.Entities = append(keyring.Entities, k.Entities...)
+	}
+	return keyring, nil
+}
+
+// readKeyRing reads binary or ASCII-armored keys from b.
+func readKeyRing(b []byte) (openpgp.EntityList, error) {
+	if len(bytes.TrimSpace(b)) == 0 {
+		return openpgp.EntityList{}, nil
+	}
+	if bytes.HasPrefix(bytes.TrimSpace(b), []byte("-----BEGIN PGP")) {
+		return readArmoredKeyRing(bytes.NewReader(b))
+	}
+	return openpgp.ReadKeyRing(bytes.NewReader(b))
+}
+
+// readArmoredKeyRing reads every ASCII-armored key block from r.
+func readArmoredKeyRing(r io.Reader) (openpgp.EntityList, error) {
+	// armor.Decode buffers its input unless given a *bufio.Reader, which would
+	// lose the start of the following block.
+	br := bufio.NewReader(r)
+	var el openpgp.EntityList
+	for {
+		block, err := armor.Decode(br)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if block.Type != openpgp.PublicKeyType && block.Type != openpgp.PrivateKeyType {
+			return nil, errors.Errorf("unexpected armor block type: %s", block.Type)
+		}
+		entities, err := openpgp.ReadKeyRing(block.Body)
+		if err != nil {
+			return nil, err
+		}
+		el = append(el, entities...)
+	}
+	if len(el) == 0 {
+		return nil, errors.New("no armored key blocks found")
+	}
+	return el, nil
+}
+
+// KeyProblem describes a key in a keyring which can no longer be used to
+// verify signatures because it has expired or been revoked.
+type KeyProblem struct {
+	Fingerprint [20]byte
+	UserID      string
+	Revoked     bool
+	Expired     bool
+	Expiry      time.Time
+}
+
+func (p KeyProblem) String() string {
+	reason := "revoked"
+	if !p.Revoked {
+		reason = "expired " + p.Expiry.Format(time.RFC1123)
+	}
+	return fmt.Sprintf("key %X (%s) %s", p.Fingerprint, p.UserID, reason)
+}
+
+// Problems returns the keys in the keyring which are revoked or have expired
+// as of now. Revoked keys are ignored when checking signatures, which then
+// fail with ErrUnknownIssuer (golang.org/x/crypto/openpgp/errors). Signatures
+// by expired keys fail with ErrSigningKeyExpired.
+func (k *EntityKeyRing) Problems(now time.Time) []KeyProblem {
+	var problems []KeyProblem
+	for _, e := range k.Entities {
+		p := KeyProblem{Fingerprint: e.PrimaryKey.Fingerprint, UserID: entityUserID(e)}
+		p.Revoked = len(e.Revocations) != 0
+		if expiry, ok := entityExpiry(e); ok {
+			p.Expiry = expiry
+			p.Expired = now.After(expiry)
+		}
+		if p.Revoked || p.Expired {
+			problems = append(problems, p)
+		}
+	}
+	return problems
+}
+
+// entityUserID returns the first user ID of e in lexical order.
+func entityUserID(e *openpgp.Entity) string {
+	var ids []string
+	for id := range e.Identities {
+		ids = append(ids, id)
+	}
+	if len(ids) == 0 {
+		return ""
+	}
+	sort.Strings(ids)
+	return ids[0]
+}
+
+// entityExpiry returns the expiry time of e's primary key taken from its most
+// recent self-signature. It returns false if the key does not expire.
+func entityExpiry(e *openpgp.Entity) (time.Time, bool) {
+	var latest *openpgp.Identity
+	for _, id := range e.Identities {
+		if id.SelfSignature == nil {
+			continue
+		}
+		if latest == nil || id.SelfSignature.CreationTime.After(latest.SelfSignature.CreationTime) {
+			latest = id
+		}
+	}
+	if latest == nil || latest.SelfSignature.KeyLifetimeSecs == nil || *latest.SelfSignature.KeyLifetimeSecs == 0 {
+		return time.Time{}, false
+	}
+	lifetime := time.Duration(*latest.SelfSignature.KeyLifetimeSecs) * time.Second
+	return e.PrimaryKey.CreationTime.Add(lifetime), true
+}
@@ -0,0 +1,138 @@
+package debrepo
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/armor"
+	pgperrors "golang.org/x/crypto/openpgp/errors"
+	"golang.org/x/crypto/openpgp/packet"
+)
+
+func TestKeyRingFromFile_TestData_ReturnsKeys(t *testing.T) {
+	tests := []struct {
+		filename string
+		keys     int
+	}{
+		{"ubuntu-archive-keyring.gpg", 4},
+		{"ubuntu-archive-removed-keys.gpg", 0},
+		{"ubuntu-master-keyring.gpg", 1},
+	}
+	for i, test := range tests {
+		keyring, err := KeyRingFromFile(filepath.Join("testdata/ubuntu-keyring_2012.05.19/keyrings", test.filename))
+		if err != nil {
+			t.Fatalf("test(%v): unexpected error: %v", i, err)
+		}
+		if expected, actual := test.keys, len(keyring.Entities); expected != actual {
+			t.Fatalf("test(%v): expected=%v actual=%v", i, expected, actual)
+		}
+	}
+}
+
+func TestKeyRingFromDir_MixedFormats_MergesKeys(t *testing.T) {
+	dir, err := ioutil.TempDir("", "debrepo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	binary := &bytes.Buffer{}
+	if err := testGenerateEntityList()[0].Serialize(binary); err != nil {
+		t.Fatal(err)
+	}
+	armored := testArmoredPublicKey(testGenerateEntityList()[0]) + "\n" + testArmoredPublicKey(testGenerateEntityList()[0])
+	files := map[string][]byte{
+		"binary.gpg":  binary.Bytes(),
+		"armored.asc": []byte(armored),
+		"empty.gpg":   nil,
+		"ignored.txt": []byte("not a key"),
+	}
+	for name, contents := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), contents, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Mkdir(filepath.Join(dir, "subdir.gpg"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	keyring, err := KeyRingFromDir(dir)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if expected, actual := 3, len(keyring.Entities); expected != actual {
+		t.Fatalf("expected=%v actual=%v", expected, actual)
+	}
+}
+
+func TestKeyRingFromArmored_NotArmored_ReturnsError(t *testing.T) {
+	if _, err := KeyRingFromArmored(bytes.NewReader([]byte("not a key"))); err == nil {
+		t.Fatal("expected error reading invalid armored keyring")
+	}
+}
+
+func TestEntityKeyRingProblems_ExpiredAndRevokedKeys_ReturnsProblems(t *testing.T) {
+	valid := testGenerateEntityList()[0]
+	expired := testGenerateEntityList()[0]
+	revoked := testGenerateEntityList()[0]
+	lifetime := uint32(time.Hour / time.Second)
+	for _, id := range expired.Identities {
+		id.SelfSignature.KeyLifetimeSecs = &lifetime
+	}
+	revoked.Revocations = append(revoked.Revocations, &packet.Signature{SigType: packet.SigTypeKeyRevocation})
+	keyring := &EntityKeyRing{Entities: openpgp.EntityList{valid, expired, revoked}}
+
+	if problems := keyring.Problems(time.Now()); len(problems) != 1 || !problems[0].Revoked {
+		t.Fatalf("expected revoked key only: %v", problems)
+	}
+	problems := keyring.Problems(time.Now().Add(2 * time.Hour))
+	if expected, actual := 2, len(problems); expected != actual {
+		t.Fatalf("expected=%v actual=%v", expected, actual)
+	}
+	if p := problems[0]; !p.Expired || p.Revoked || p.Fingerprint != expired.PrimaryKey.Fingerprint {
+		t.Fatalf("expected expired key: %v", p)
+	}
+}
+
+func TestEntityKeyRingProblems_ProblemKeys_FailSignatureCheck(t *testing.T) {
+	tests := []struct {
+		expired bool
+		revoked bool
+		err     error
+	}{
+		{false, false, nil},
+		{true, false, ErrSigningKeyExpired},
+		{false, true, pgperrors.ErrUnknownIssuer},
+	}
+	for i, test := range tests {
+		_, release, releaseGPG, keyRing := newTestKeyRingAndRelease()
+		entity := keyRing.(*testKeyRing).el[0]
+		if test.expired {
+			lifetime := uint32(1)
+			for _, id := range entity.Identities {
+				id.SelfSignature.KeyLifetimeSecs = &lifetime
+			}
+		}
+		if test.revoked {
+			entity.Revocations = append(entity.Revocations, &packet.Signature{SigType: packet.SigTypeKeyRevocation})
+		}
+		keyring := &EntityKeyRing{Entities: openpgp.EntityList{entity}}
+		now := time.Now().Add(time.Hour)
+		if expected, actual := test.expired || test.revoked, len(keyring.Problems(now)) == 1; expected != actual {
+			t.Fatalf("test(%v): problem: expected=%v actual=%v", i, expected, actual)
+		}
+		signature, err := armor.Decode(bytes.NewReader(releaseGPG))
+		if err != nil {
+			t.Fatal(err)
+		}
+		r := &Release{Plaintext: release, ArmoredSignature: signature}
+		_, err = r.Verify(keyring.KeyRing(), SignaturePolicy{Now: func() time.Time { return now }})
+		if expected, actual := test.err, errors.Cause(err); expected != actual {
+			t.Fatalf("test(%v): expected=%v actual=%v", i, expected, actual)
+		}
+	}
+}
@@ -0,0 +1,394 @@
+package debrepo
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/hex"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Unmarshal parses the first deb822 paragraph in data and stores the result in
+// the struct pointed to by v. See UnmarshalFields.
+func Unmarshal(data []byte, v interface{}) error {
+	fields, err := ReadFields(data)
+	if err != nil {
+		return err
+	}
+	return UnmarshalFields(fields, v)
+}
+
+// UnmarshalFields stores fields in the struct pointed to by v.
+//
+// Struct fields are matched to deb822 fields using the name in their deb822
+// tag, or the Go field name if the tag has none. Names are compared
+// case-insensitively. Fields tagged "-" and unexported fields are ignored.
+// Struct fields whose deb822 field is not present are left unchanged.
+//
+// The following types are supported:
+//
+//   - string receives the value unchanged, including any continuation lines.
+//   - Signed and unsigned integers are parsed in base 10.
+//   - bool is parsed from "yes" or "no".
+//   - time.Time is parsed from an RFC 2822 date, as used in Release files.
+//   - []byte is parsed from a hex encoded checksum.
+//   - Types implementing encoding.TextUnmarshaler, such as Dependencies.
+//   - Slices of structs are parsed as multiline tables such as the checksum
+//     tables of Release files. Each non-empty line is split on whitespace and
+//     the columns are stored in the exported fields of the struct in order.
+//   - Other slices are split on commas and whitespace and each element is
+//     parsed as above.
+//
+// A struct field of type Fields without a name in its tag receives every
+// field which is not matched by another struct field.
+func UnmarshalFields(fields Fields, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return errors.Errorf("unmarshal requires a non-nil pointer to a struct, got %T", v)
+	}
+	sv := rv.Elem()
+	codec, err := newStructCodec(sv.Type())
+	if err != nil {
+		return err
+	}
+	for _, sf := range codec.fields {
+		value, ok := fields.Lookup(sf.name)
+		if !ok {
+			continue
+		}
+		if err := unmarshalValue(sv.Field(sf.index), value); err != nil {
+			return errors.Wrapf(err, "field %s", sf.name)
+		}
+	}
+	if codec.rest >= 0 {
+		var rest Fields
+		for _, field := range fields {
+			if !codec.has(field.Name) {
+				rest = append(rest, field)
+			}
+		}
+		sv.Field(codec.rest).Set(reflect.ValueOf(rest))
+	}
+	return nil
+}
+
+// Marshal returns the deb822 paragraph for the struct v, or a pointer to one.
+// See MarshalFields.
+func Marshal(v interface{}) ([]byte, error) {
+	fields, err := MarshalFields(v)
+	if err != nil {
+		return nil, err
+	}
+	buf := &bytes.Buffer{}
+	if err := WriteFields(buf, fields); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// MarshalFields returns the fields of the struct v, or a pointer to one, in
+// the order they are declared, followed by the fields of the catch-all Fields
+// struct field. Struct fields are named and encoded as described for
+// UnmarshalFields. Slices are joined with spaces, or with ", " if the tag has
+// the "comma" option. Times are written in UTC. Struct fields with the
+// "omitempty" option are skipped if they are empty.
+func MarshalFields(v interface{}) (Fields, error) {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			return nil, errors.New("marshal of nil pointer")
+		}
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return nil, errors.Errorf("marshal requires a struct, got %T", v)
+	}
+	codec, err := newStructCodec(rv.Type())
+	if err != nil {
+		return nil, err
+	}
+	var fields Fields
+	for _, sf := range codec.fields {
+		fv := rv.Field(sf.index)
+		if sf.omitEmpty && isEmptyValue(fv) {
+			continue
+		}
+		value, err := marshalValue(fv, sf.comma)
+		if err != nil {
+			return nil, errors.Wrapf(err, "field %s", sf.name)
+		}
+		fields = append(fields, Field{Name: sf.name, Value: value})
+	}
+	if codec.rest >= 0 {
+		for _, field := range rv.Field(codec.rest).Interface().(Fields) {
+			if !codec.has(field.Name) {
+				fields = append(fields, field)
+			}
+		}
+	}
+	return fields, nil
+}
+
+var (
+	fieldsType = reflect.TypeOf(Fields(nil))
+	timeType   = reflect.TypeOf(time.Time{})
+	bytesType  = reflect.TypeOf([]byte(nil))
+
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+	textMarshalerType   = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// structCodec describes how the fields of a struct type map to deb822 fields.
+// rest is the index of the catch-all Fields struct field, or -1.
+type structCodec struct {
+	fields []codecField
+	rest   int
+}
+
+type codecField struct {
+	name      string
+	index     int
+	omitEmpty bool
+	comma     bool
+}
+
+func newStructCodec(t reflect.Type) (*structCodec, error) {
+	codec := &structCodec{rest: -1}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("deb822")
+		if len(f.PkgPath) != 0 || tag == "-" {
+			continue
+		}
+		opts := strings.Split(tag, ",")
+		name := opts[0]
+		if len(name) == 0 && f.Type == fieldsType {
+			if codec.rest >= 0 {
+				return nil, errors.Errorf("%s: more than one catch-all Fields", t)
+			}
+			codec.rest = i
+			continue
+		}
+		if len(name) == 0 {
+			name = f.Name
+		}
+		if codec.has(name) {
+			return nil, errors.Errorf("%s: duplicate field %s", t, name)
+		}
+		cf := codecField{name: name, index: i}
+		for _, opt := range opts[1:] {
+			switch opt {
+			case "omitempty":
+				cf.omitEmpty = true
+			case "comma":
+				cf.comma = true
+			default:
+				return nil, errors.Errorf("%s: unknown option %q on field %s", t, opt, f.Name)
+			}
+		}
+		codec.fields = append(codec.fields, cf)
+	}
+	return codec, nil
+}
+
+// has returns true if a struct field is mapped to the deb822 field name.
+func (c *structCodec) has(name string) bool {
+	for _, f := range c.fields {
+		if strings.EqualFold(f.name, name) {
+			return true
+		}
+	}
+	return false
+}
+
+func unmarshalValue(v reflect.Value, s string) error {
+	if v.Type() == timeType {
+		t, err := parseReleaseDate(s)
+		if err != nil {
+			return err
+		}
+		v.Set(reflect.ValueOf(t))
+		return nil
+	}
+	if reflect.PtrTo(v.Type()).Implements(textUnmarshalerType) {
+		return v.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(s))
+	}
+	if v.Type() == bytesType {
+		b, err := hex.DecodeString(strings.TrimSpace(s))
+		if err != nil {
+			return err
+		}
+		v.SetBytes(b)
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(strings.TrimSpace(s), 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(strings.TrimSpace(s), 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(n)
+	case reflect.Bool:
+		switch strings.ToLower(strings.TrimSpace(s)) {
+		case "yes":
+			v.SetBool(true)
+		case "no":
+			v.SetBool(false)
+		default:
+			return errors.Errorf("invalid boolean %q", s)
+		}
+	case reflect.Slice:
+		if isTableType(v.Type()) {
+			return unmarshalTable(v, s)
+		}
+		items := splitOptionValues(s)
+		slice := reflect.MakeSlice(v.Type(), len(items), len(items))
+		for i, item := range items {
+			if err := unmarshalValue(slice.Index(i), item); err != nil {
+				return err
+			}
+		}
+		v.Set(slice)
+	default:
+		return errors.Errorf("unsupported type %s", v.Type())
+	}
+	return nil
+}
+
+// isTableType returns true if t is a slice of structs, which is encoded as a
+// multiline table. Structs with their own text encoding, such as Version, are
+// not table rows.
+func isTableType(t reflect.Type) bool {
+	if t.Kind() != reflect.Slice || t.Elem().Kind() != reflect.Struct || t.Elem() == timeType {
+		return false
+	}
+	return !reflect.PtrTo(t.Elem()).Implements(textUnmarshalerType)
+}
+
+// tableColumns returns the indexes of the struct fields of t which hold the
+// columns of a table row.
+func tableColumns(t reflect.Type) []int {
+	var columns []int
+	for i := 0; i < t.NumField(); i++ {
+		if f := t.Field(i); len(f.PkgPath) == 0 && f.Tag.Get("deb822") != "-" {
+			columns = append(columns, i)
+		}
+	}
+	return columns
+}
+
+func unmarshalTable(v reflect.Value, s string) error {
+	columns := tableColumns(v.Type().Elem())
+	rows := reflect.MakeSlice(v.Type(), 0, strings.Count(s, "\n"))
+	for _, line := range strings.Split(s, "\n") {
+		cols := strings.Fields(line)
+		if len(cols) == 0 {
+			continue
+		}
+		if len(cols) != len(columns) {
+			return errors.Errorf("table row %q: expected %d columns, found %d", line, len(columns), len(cols))
+		}
+		row := reflect.New(v.Type().Elem()).Elem()
+		for i, col := range cols {
+			if err := unmarshalValue(row.Field(columns[i]), col); err != nil {
+				return errors.Wrapf(err, "table row %q", line)
+			}
+		}
+		rows = reflect.Append(rows, row)
+	}
+	v.Set(rows)
+	return nil
+}
+
+func marshalValue(v reflect.Value, comma bool) (string, error) {
+	if v.Type() == timeType {
+		return v.Interface().(time.Time).UTC().Format("Mon, 02 Jan 2006 15:04:05 MST"), nil
+	}
+	if v.Type().Implements(textMarshalerType) {
+		b, err := v.Interface().(encoding.TextMarshaler).MarshalText()
+		return string(b), err
+	}
+	if v.Type() == bytesType {
+		return hex.EncodeToString(v.Bytes()), nil
+	}
+	switch v.Kind() {
+	case reflect.String:
+		return v.String(), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(v.Uint(), 10), nil
+	case reflect.Bool:
+		if v.Bool() {
+			return "yes", nil
+		}
+		return "no", nil
+	case reflect.Slice:
+		if isTableType(v.Type()) {
+			return marshalTable(v)
+		}
+		items := make([]string, v.Len())
+		for i := range items {
+			item, err := marshalValue(v.Index(i), false)
+			if err != nil {
+				return "", err
+			}
+			items[i] = item
+		}
+		if comma {
+			return strings.Join(items, ", "), nil
+		}
+		return strings.Join(items, " "), nil
+	}
+	return "", errors.Errorf("unsupported type %s", v.Type())
+}
+
+// marshalTable encodes the rows of v on the lines following an empty first
+// line, as in the checksum tables of Release files.
+func marshalTable(v reflect.Value) (string, error) {
+	columns := tableColumns(v.Type().Elem())
+	lines := make([]string, v.Len()+1)
+	for i := 0; i < v.Len(); i++ {
+		cols := make([]string, len(columns))
+		for j, index := range columns {
+			col, err := marshalValue(v.Index(i).Field(index), false)
+			if err != nil {
+				return "", err
+			}
+			cols[j] = col
+		}
+		lines[i+1] = strings.Join(cols, " ")
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+// isEmptyValue returns true if v is the zero value of its type or an empty
+// slice.
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return v.Uint() == 0
+	}
+	if v.Type() == timeType {
+		return v.Interface().(time.Time).IsZero()
+	}
+	return false
+}
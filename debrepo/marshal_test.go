@@ -0,0 +1,160 @@
+package debrepo
+
+import (
+	"io/ioutil"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type testChecksum struct {
+	Sum  []byte
+	Size int64
+	Name string
+}
+
+type testControl struct {
+	Package       string         `deb822:"Package"`
+	Version       Version        `deb822:"Version"`
+	InstalledSize int            `deb822:"Installed-Size"`
+	Essential     bool           `deb822:"Essential,omitempty"`
+	Date          time.Time      `deb822:"Date"`
+	Architectures []string       `deb822:"Architecture"`
+	Uploaders     []string       `deb822:"Uploaders,comma,omitempty"`
+	Depends       Dependencies   `deb822:"Depends,omitempty"`
+	Description   string         `deb822:"Description"`
+	SHA256        []testChecksum `deb822:"Checksums-Sha256"`
+	Ignored       string         `deb822:"-"`
+	Extra         Fields
+}
+
+const testControlParagraph = `Package: hello
+Version: 2.10-1
+Installed-Size: 280
+Date: Sat, 01 Oct 2016 08:21:38 UTC
+Architecture: amd64 i386
+Depends: libc6 (>= 2.14), foo | bar
+Description: example package
+ longer description
+ .
+ second paragraph
+Checksums-Sha256:
+ 8d6ab57abf517d7712e4e4d23d762485af49f8140a83b221ea7282f82a51c795 1557985 hello_2.10.orig.tar.gz
+ 974c021c888f99cdfe9562e5f952484a974c021c888f99cdfe9562e5f952484a 6132 hello_2.10-1.debian.tar.xz
+Homepage: http://www.gnu.org/software/hello/
+`
+
+func TestUnmarshal(t *testing.T) {
+	var actual testControl
+	if err := Unmarshal([]byte(testControlParagraph), &actual); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	deps, _ := ParseDependencies("libc6 (>= 2.14), foo | bar")
+	expected := testControl{
+		Package:       "hello",
+		Version:       Version{Upstream: "2.10", Revision: "1"},
+		InstalledSize: 280,
+		Date:          time.Date(2016, time.October, 1, 8, 21, 38, 0, time.UTC),
+		Architectures: []string{"amd64", "i386"},
+		Depends:       deps,
+		Description:   "example package\nlonger description\n\nsecond paragraph",
+		SHA256: []testChecksum{
+			{decodeHexString("8d6ab57abf517d7712e4e4d23d762485af49f8140a83b221ea7282f82a51c795"), 1557985, "hello_2.10.orig.tar.gz"},
+			{decodeHexString("974c021c888f99cdfe9562e5f952484a974c021c888f99cdfe9562e5f952484a"), 6132, "hello_2.10-1.debian.tar.xz"},
+		},
+		Extra: Fields{{"Homepage", "http://www.gnu.org/software/hello/"}},
+	}
+	if !reflect.DeepEqual(expected, actual) {
+		t.Fatalf("\nexpected=%+v\nactual=%+v", expected, actual)
+	}
+}
+
+func TestMarshal_RoundTrips(t *testing.T) {
+	var control testControl
+	if err := Unmarshal([]byte(testControlParagraph), &control); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	b, err := Marshal(&control)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if expected, actual := testControlParagraph, string(b); expected != actual {
+		t.Fatalf("\nexpected=%q\nactual=%q", expected, actual)
+	}
+}
+
+func TestMarshal_Options(t *testing.T) {
+	control := testControl{
+		Package:   "hello",
+		Essential: true,
+		Uploaders: []string{"a@example.com", "b@example.com"},
+		Ignored:   "ignored",
+	}
+	fields, err := MarshalFields(control)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if expected, actual := "yes", fields.Get("Essential"); expected != actual {
+		t.Fatalf("essential: expected=%q actual=%q", expected, actual)
+	}
+	if expected, actual := "a@example.com, b@example.com", fields.Get("Uploaders"); expected != actual {
+		t.Fatalf("uploaders: expected=%q actual=%q", expected, actual)
+	}
+	if _, ok := fields.Lookup("Depends"); ok {
+		t.Fatal("expected empty Depends to be omitted")
+	}
+	if _, ok := fields.Lookup("Ignored"); ok {
+		t.Fatal("expected field tagged - to be omitted")
+	}
+}
+
+func TestUnmarshal_TestDataRelease(t *testing.T) {
+	b, err := ioutil.ReadFile("testdata/test_repo/ubuntu/dists/xenial/Release")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var release struct {
+		Codename      string
+		Date          time.Time
+		Architectures []string
+		AcquireByHash bool           `deb822:"Acquire-By-Hash"`
+		SHA256        []testChecksum `deb822:"SHA256"`
+	}
+	if err := Unmarshal(b, &release); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if expected, actual := "xenial", release.Codename; expected != actual {
+		t.Fatalf("codename: expected=%v actual=%v", expected, actual)
+	}
+	if expected, actual := 7, len(release.Architectures); expected != actual {
+		t.Fatalf("architectures: expected=%v actual=%v", expected, actual)
+	}
+	if !release.AcquireByHash {
+		t.Fatal("expected Acquire-By-Hash to be true")
+	}
+	if len(release.SHA256) < 800 {
+		t.Fatalf("expected at least 800 files parsed, was: %v", len(release.SHA256))
+	}
+}
+
+func TestUnmarshal_InvalidInput_ReturnsError(t *testing.T) {
+	tests := []struct {
+		input string
+		v     interface{}
+	}{
+		{"Installed-Size: big\n", &testControl{}},
+		{"Essential: maybe\n", &testControl{}},
+		{"Date: yesterday\n", &testControl{}},
+		{"Depends: foo (\n", &testControl{}},
+		{"Checksums-Sha256:\n 8d6ab57abf517d77 1557985\n", &testControl{}},
+		{"Checksums-Sha256:\n Z8d6ab57abf517d77 1557985 file\n", &testControl{}},
+		{"Package: hello\n", testControl{}},
+		{"Package: hello\n", (*testControl)(nil)},
+		{"Value: 1\n", &struct{ Value float64 }{}},
+	}
+	for i, test := range tests {
+		if err := Unmarshal([]byte(test.input), test.v); err == nil {
+			t.Fatalf("test(%v): expected error", i)
+		}
+	}
+}
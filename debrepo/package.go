@@ -0,0 +1,163 @@
+package debrepo
+
+import (
+	"encoding/hex"
+	"io"
+	"strconv"
+
+	"github.com/pkg/errors"
+)
+
+// Package is a binary package entry read from a Packages index file.
+//
+// Fields contains every field present in the entry, including those which
+// have no corresponding struct field.
+type Package struct {
+	Package       string
+	Source        string
+	Version       string
+	Architecture  string
+	MultiArch     string
+	Essential     bool
+	Priority      string
+	Section       string
+	InstalledSize int64
+	Maintainer    string
+	Depends       Dependencies
+	PreDepends    Dependencies
+	Recommends    Dependencies
+	Suggests      Dependencies
+	Enhances      Dependencies
+	Breaks        Dependencies
+	Conflicts     Dependencies
+	Provides      Dependencies
+	Replaces      Dependencies
+	Filename      string
+	Size          int64
+	MD5Sum        []byte
+	SHA1          []byte
+	SHA256        []byte
+	SHA512        []byte
+	Homepage      string
+	Description   string
+	Fields        Fields
+}
+
+// PackageReader reads the entries of a Packages index one at a time.
+type PackageReader struct {
+	r *ParagraphReader
+}
+
+// NewPackageReader returns a PackageReader which reads the uncompressed index
+// r.
+func NewPackageReader(r io.Reader) *PackageReader {
+	return &PackageReader{r: NewParagraphReader(r)}
+}
+
+// Read returns the next Package, or io.EOF at the end of the index.
+func (pr *PackageReader) Read() (*Package, error) {
+	fields, err := pr.r.Read()
+	if err != nil {
+		return nil, err
+	}
+	return parsePackage(fields)
+}
+
+// ReadAll returns the remaining Package entries in the index.
+func (pr *PackageReader) ReadAll() ([]*Package, error) {
+	var pkgs []*Package
+	for {
+		pkg, err := pr.Read()
+		if err == io.EOF {
+			return pkgs, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		pkgs = append(pkgs, pkg)
+	}
+}
+
+func parsePackage(fields Fields) (*Package, error) {
+	pkg := &Package{
+		Package:      fields.Get("Package"),
+		Source:       fields.Get("Source"),
+		Version:      fields.Get("Version"),
+		Architecture: fields.Get("Architecture"),
+		MultiArch:    fields.Get("Multi-Arch"),
+		Essential:    fields.Get("Essential") == "yes",
+		Priority:     fields.Get("Priority"),
+		Section:      fields.Get("Section"),
+		Maintainer:   fields.Get("Maintainer"),
+		Filename:     fields.Get("Filename"),
+		Homepage:     fields.Get("Homepage"),
+		Description:  fields.Get("Description"),
+		Fields:       fields,
+	}
+	if len(pkg.Package) == 0 {
+		return nil, errors.New("package entry missing Package field")
+	}
+
+	var err error
+	if pkg.InstalledSize, err = parsePackageInt(fields, "Installed-Size"); err != nil {
+		return nil, errors.Wrapf(err, "package %s", pkg.Package)
+	}
+	if pkg.Size, err = parsePackageInt(fields, "Size"); err != nil {
+		return nil, errors.Wrapf(err, "package %s", pkg.Package)
+	}
+	relations := []struct {
+		field string
+		dst   *Dependencies
+	}{
+		{"Depends", &pkg.Depends},
+		{"Pre-Depends", &pkg.PreDepends},
+		{"Recommends", &pkg.Recommends},
+		{"Suggests", &pkg.Suggests},
+		{"Enhances", &pkg.Enhances},
+		{"Breaks", &pkg.Breaks},
+		{"Conflicts", &pkg.Conflicts},
+		{"Provides", &pkg.Provides},
+		{"Replaces", &pkg.Replaces},
+	}
+	for _, r := range relations {
+		if *r.dst, err = ParseDependencies(fields.Get(r.field)); err != nil {
+			return nil, errors.Wrapf(err, "package %s: invalid %s field", pkg.Package, r.field)
+		}
+	}
+	hashes := []struct {
+		field string
+		dst   *[]byte
+	}{
+		{"MD5sum", &pkg.MD5Sum},
+		{"SHA1", &pkg.SHA1},
+		{"SHA256", &pkg.SHA256},
+		{"SHA512", &pkg.SHA512},
+	}
+	for _, h := range hashes {
+		v := fields.Get(h.field)
+		if len(v) == 0 {
+			continue
+		}
+		if *h.dst, err = hex.DecodeString(v); err != nil {
+			return nil, errors.Wrapf(err, "package %s: invalid %s field", pkg.Package, h.field)
+		}
+	}
+	return pkg, nil
+}
+
+// parsePackageInt parses the non-negative integer value of field. It returns 0
+// if the field is not present.
+func parsePackageInt(fields Fields, field string) (int64, error) {
+	v := fields.Get(field)
+	if len(v) == 0 {
+		return 0, nil
+	}
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return 0, errors.Wrapf(err, "invalid %s field", field)
+	}
+	if n < 0 {
+		return 0, errors.Errorf("negative %s field", field)
+	}
+	return n, nil
+}
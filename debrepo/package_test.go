@@ -0,0 +1,124 @@
+package debrepo
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"reflect"
+	"testing"
+)
+
+const testPackages = `Package: a11y-profile-manager
+Priority: optional
+Section: misc
+Installed-Size: 27
+Maintainer: Luke Yelavich <themuso@ubuntu.com>
+Architecture: amd64
+Version: 0.1.10-0ubuntu3
+Depends: liba11y-profile-manager-0.1-0 (>= 0.1.3), libc6 (>= 2.4), libglib2.0-0 (>= 2.26.0)
+Filename: pool/main/a/a11y-profile-manager/a11y-profile-manager_0.1.10-0ubuntu3_amd64.deb
+Size: 6276
+MD5sum: a9d0d5ead1c417e81cadd0227f285f92
+SHA1: b63e87f06fa29f33f4990d9d8563752b6c6f7910
+SHA256: 863d375123f65eb2bef53fbea936379275da9e9b63dc18ba378cb3a4adcc82eb
+Description: Accessibility Profile Manager - Command-line utility
+Multi-Arch: foreign
+Homepage: https://launchpad.net/a11y-profile-manager
+Supported: 5y
+
+
+Package: a11y-profile-manager-doc
+Architecture: all
+Source: a11y-profile-manager
+Version: 0.1.10-0ubuntu3
+Essential: yes
+Filename: pool/main/a/a11y-profile-manager/a11y-profile-manager-doc_0.1.10-0ubuntu3_all.deb
+Size: 13512`
+
+func TestPackageReader_Read(t *testing.T) {
+	pr := NewPackageReader(bytes.NewBufferString(testPackages))
+	pkg, err := pr.Read()
+	if err != nil {
+		t.Fatalf("unexpected error reading first package: %v", err)
+	}
+	expected := &Package{
+		Package:       "a11y-profile-manager",
+		Version:       "0.1.10-0ubuntu3",
+		Architecture:  "amd64",
+		MultiArch:     "foreign",
+		Priority:      "optional",
+		Section:       "misc",
+		InstalledSize: 27,
+		Maintainer:    "Luke Yelavich <themuso@ubuntu.com>",
+		Depends: Dependencies{
+			{{Name: "liba11y-profile-manager-0.1-0", Op: RelationGreaterEqual, Version: Version{Upstream: "0.1.3"}}},
+			{{Name: "libc6", Op: RelationGreaterEqual, Version: Version{Upstream: "2.4"}}},
+			{{Name: "libglib2.0-0", Op: RelationGreaterEqual, Version: Version{Upstream: "2.26.0"}}},
+		},
+		Filename:    "pool/main/a/a11y-profile-manager/a11y-profile-manager_0.1.10-0ubuntu3_amd64.deb",
+		Size:        6276,
+		MD5Sum:      decodeHexString("a9d0d5ead1c417e81cadd0227f285f92"),
+		SHA1:        decodeHexString("b63e87f06fa29f33f4990d9d8563752b6c6f7910"),
+		SHA256:      decodeHexString("863d375123f65eb2bef53fbea936379275da9e9b63dc18ba378cb3a4adcc82eb"),
+		Homepage:    "https://launchpad.net/a11y-profile-manager",
+		Description: "Accessibility Profile Manager - Command-line utility",
+		Fields:      pkg.Fields,
+	}
+	if !reflect.DeepEqual(expected, pkg) {
+		t.Fatalf("first package:\nexpected=%+v\nactual=%+v", expected, pkg)
+	}
+	if expected, actual := "5y", pkg.Fields.Get("Supported"); expected != actual {
+		t.Fatalf("unknown field: expected=%v actual=%v", expected, actual)
+	}
+
+	pkg, err = pr.Read()
+	if err != nil {
+		t.Fatalf("unexpected error reading second package: %v", err)
+	}
+	if expected, actual := "a11y-profile-manager", pkg.Source; expected != actual {
+		t.Fatalf("second package source: expected=%v actual=%v", expected, actual)
+	}
+	if !pkg.Essential {
+		t.Fatal("second package: expected essential")
+	}
+	if _, err := pr.Read(); err != io.EOF {
+		t.Fatalf("expected io.EOF after last package, got: %v", err)
+	}
+}
+
+var packageReaderInvalidTests = []string{
+	"Version: 1.0\n",                              // missing Package
+	"Package: a\nSize: abc\n",                     // invalid size
+	"Package: a\nInstalled-Size: -1\n",            // negative installed size
+	"Package: a\nSHA256: zz3d375123f65eb2bef53\n", // invalid hash
+	"Package: a\nDepends: b (>= )\n",              // invalid relation
+}
+
+func TestPackageReader_Read_InvalidEntry_ReturnsError(t *testing.T) {
+	for i, test := range packageReaderInvalidTests {
+		pr := NewPackageReader(bytes.NewBufferString(test))
+		if _, err := pr.Read(); err == nil || err == io.EOF {
+			t.Fatalf("test(%v): expected error, got: %v", i, err)
+		}
+	}
+}
+
+func TestPackageReader_ReadAll_TestRepository(t *testing.T) {
+	f, err := os.Open("testdata/test_repo/ubuntu/dists/xenial/main/binary-amd64/Packages.gz")
+	if err != nil {
+		t.Fatalf("unexpected error opening Packages file: %v", err)
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatalf("unexpected error decompressing Packages file: %v", err)
+	}
+	pkgs, err := NewPackageReader(gz).ReadAll()
+	if err != nil {
+		t.Fatalf("unexpected error reading packages: %v", err)
+	}
+	if expected, actual := 7322, len(pkgs); expected != actual {
+		t.Fatalf("number of packages: expected=%v actual=%v", expected, actual)
+	}
+}
@@ -0,0 +1,314 @@
+package debrepo
+
+import (
+	"bufio"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// filePatch is the set of changes made to a single file by a unified diff.
+type filePatch struct {
+	oldName string
+	newName string
+	hunks   []*hunk
+}
+
+// hunk is a hunk of a unified diff. Each line keeps its ' ', '-' or '+'
+// prefix and its trailing newline, which is missing if the line was followed
+// by a "\ No newline at end of file" marker.
+type hunk struct {
+	oldStart int
+	oldLines int
+	newStart int
+	newLines int
+	lines    []string
+}
+
+// applyPatch applies the unified diff read from r to the files under root,
+// removing strip leading components from the file names in the diff, as
+// "patch -p<strip>" does. Hunks are applied at the position given in the diff
+// or, failing that, at the nearest position where their context matches
+// exactly. Files are created and deleted as described by the diff. Paths are
+// checked as described for securePath.
+func applyPatch(root string, r io.Reader, strip int) error {
+	patches, err := parsePatch(r)
+	if err != nil {
+		return err
+	}
+	for _, p := range patches {
+		if err := p.apply(root, strip); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func parsePatch(r io.Reader) ([]*filePatch, error) {
+	var lines []string
+	br := bufio.NewReader(r)
+	for {
+		line, err := br.ReadString('\n')
+		if len(line) != 0 {
+			lines = append(lines, line)
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	var patches []*filePatch
+	var cur *filePatch
+	for i := 0; i < len(lines); {
+		line := lines[i]
+		switch {
+		case strings.HasPrefix(line, "--- ") && i+1 < len(lines) && strings.HasPrefix(lines[i+1], "+++ "):
+			cur = &filePatch{
+				oldName: patchFileName(line[4:]),
+				newName: patchFileName(lines[i+1][4:]),
+			}
+			patches = append(patches, cur)
+			i += 2
+		case strings.HasPrefix(line, "@@ ") && cur != nil:
+			h, n, err := parseHunk(lines[i:])
+			if err != nil {
+				return nil, errors.Wrapf(err, "%s: line %d", cur.newName, i+1)
+			}
+			cur.hunks = append(cur.hunks, h)
+			i += n
+		case strings.HasPrefix(line, "GIT binary patch"), strings.HasPrefix(line, "Binary files "):
+			return nil, errors.Errorf("line %d: binary patches are not supported", i+1)
+		default:
+			// Patch descriptions and diff command lines are ignored.
+			i++
+		}
+	}
+	return patches, nil
+}
+
+// patchFileName returns the file name from a "---" or "+++" line, without the
+// timestamp which may follow it.
+func patchFileName(s string) string {
+	s = strings.TrimRight(s, "\r\n")
+	if i := strings.IndexByte(s, '\t'); i >= 0 {
+		s = s[:i]
+	}
+	return strings.TrimSpace(s)
+}
+
+// parseHunk parses the hunk starting at lines[0] and returns the number of
+// lines it spans.
+func parseHunk(lines []string) (*hunk, int, error) {
+	header := strings.Fields(lines[0])
+	if len(header) < 4 || header[3] != "@@" || !strings.HasPrefix(header[1], "-") || !strings.HasPrefix(header[2], "+") {
+		return nil, 0, errors.Errorf("invalid hunk header %q", strings.TrimSpace(lines[0]))
+	}
+	h := &hunk{}
+	var err error
+	if h.oldStart, h.oldLines, err = parseHunkRange(header[1][1:]); err != nil {
+		return nil, 0, err
+	}
+	if h.newStart, h.newLines, err = parseHunkRange(header[2][1:]); err != nil {
+		return nil, 0, err
+	}
+	oldLines, newLines := h.oldLines, h.newLines
+	n := 1
+	for ; oldLines > 0 || newLines > 0; n++ {
+		if n >= len(lines) {
+			return nil, 0, errors.New("unexpected end of hunk")
+		}
+		line := lines[n]
+		switch line[0] {
+		case ' ', '\n', '\r':
+			// Some tools strip the space from empty context lines.
+			if line[0] != ' ' {
+				line = " " + line
+			}
+			oldLines--
+			newLines--
+		case '-':
+			oldLines--
+		case '+':
+			newLines--
+		case '\\':
+			h.noNewline()
+			continue
+		default:
+			return nil, 0, errors.Errorf("invalid hunk line %q", strings.TrimSpace(line))
+		}
+		if oldLines < 0 || newLines < 0 {
+			return nil, 0, errors.New("hunk longer than its header")
+		}
+		h.lines = append(h.lines, line)
+	}
+	if n < len(lines) && strings.HasPrefix(lines[n], "\\") {
+		h.noNewline()
+		n++
+	}
+	return h, n, nil
+}
+
+// parseHunkRange parses a "start,lines" range of a hunk header. The number of
+// lines is 1 if omitted.
+func parseHunkRange(s string) (start, lines int, err error) {
+	lines = 1
+	if i := strings.IndexByte(s, ','); i >= 0 {
+		if lines, err = strconv.Atoi(s[i+1:]); err != nil {
+			return 0, 0, errors.Errorf("invalid hunk range %q", s)
+		}
+		s = s[:i]
+	}
+	if start, err = strconv.Atoi(s); err != nil {
+		return 0, 0, errors.Errorf("invalid hunk range %q", s)
+	}
+	return start, lines, nil
+}
+
+// noNewline removes the newline from the last line of the hunk, after a
+// "\ No newline at end of file" marker.
+func (h *hunk) noNewline() {
+	if n := len(h.lines); n != 0 {
+		h.lines[n-1] = strings.TrimSuffix(h.lines[n-1], "\n")
+	}
+}
+
+// split returns the lines the hunk expects to find and the lines it replaces
+// them with, without their prefixes.
+func (h *hunk) split() (old, new []string) {
+	for _, line := range h.lines {
+		switch line[0] {
+		case ' ':
+			old = append(old, line[1:])
+			new = append(new, line[1:])
+		case '-':
+			old = append(old, line[1:])
+		case '+':
+			new = append(new, line[1:])
+		}
+	}
+	return old, new
+}
+
+func (p *filePatch) apply(root string, strip int) error {
+	name := p.newName
+	if name == "/dev/null" {
+		name = p.oldName
+	}
+	name, err := stripPatchPath(name, strip)
+	if err != nil {
+		return err
+	}
+	target, err := securePath(root, name)
+	if err != nil {
+		return err
+	}
+	var orig []string
+	mode := os.FileMode(0644)
+	fi, err := os.Lstat(target)
+	switch {
+	case err == nil && !fi.Mode().IsRegular():
+		return errors.Wrapf(ErrUnsafePath, "patch of non-regular file %s", name)
+	case err == nil:
+		b, err := ioutil.ReadFile(target)
+		if err != nil {
+			return err
+		}
+		orig = splitLines(string(b))
+		mode = fi.Mode().Perm()
+	case !os.IsNotExist(err):
+		return err
+	}
+	result, err := applyHunks(orig, p.hunks)
+	if err != nil {
+		return errors.Wrapf(err, "patch of %s", name)
+	}
+	if p.newName == "/dev/null" {
+		if len(result) != 0 {
+			return errors.Errorf("patch of %s: file to delete is not empty after patch", name)
+		}
+		return os.Remove(target)
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(target, []byte(strings.Join(result, "")), mode)
+}
+
+// stripPatchPath removes strip leading components from name.
+func stripPatchPath(name string, strip int) (string, error) {
+	parts := strings.Split(name, "/")
+	if len(parts) <= strip {
+		return "", errors.Errorf("cannot strip %d components from %s", strip, name)
+	}
+	return strings.Join(parts[strip:], "/"), nil
+}
+
+// splitLines splits s after each newline.
+func splitLines(s string) []string {
+	var lines []string
+	for len(s) != 0 {
+		i := strings.IndexByte(s, '\n') + 1
+		if i == 0 {
+			i = len(s)
+		}
+		lines = append(lines, s[:i])
+		s = s[i:]
+	}
+	return lines
+}
+
+// applyHunks returns orig with hunks applied. Each hunk is applied at the
+// position given in its header, adjusted by the offset at which the previous
+// hunk applied, or at the nearest position after the previous hunk where its
+// expected lines match.
+func applyHunks(orig []string, hunks []*hunk) ([]string, error) {
+	var out []string
+	pos, offset := 0, 0
+	for i, h := range hunks {
+		old, new := h.split()
+		base := h.oldStart - 1
+		if h.oldLines == 0 {
+			// Insertions are made after line oldStart.
+			base = h.oldStart
+		}
+		at := findHunk(orig, old, pos, base+offset)
+		if at < 0 {
+			return nil, errors.Errorf("hunk %d at line %d does not apply", i+1, h.oldStart)
+		}
+		out = append(out, orig[pos:at]...)
+		out = append(out, new...)
+		pos = at + len(old)
+		offset = at - base
+	}
+	return append(out, orig[pos:]...), nil
+}
+
+// findHunk returns the position of old in orig nearest to want, not before
+// min. It returns -1 if old is not found.
+func findHunk(orig, old []string, min, want int) int {
+	max := len(orig) - len(old)
+	for d := 0; want-d >= min || want+d <= max; d++ {
+		for _, at := range [...]int{want - d, want + d} {
+			if at >= min && at <= max && linesEqual(orig[at:at+len(old)], old) {
+				return at
+			}
+		}
+	}
+	return -1
+}
+
+func linesEqual(a, b []string) bool {
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,113 @@
+package debrepo
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var applyHunksTests = []struct {
+	orig     string
+	patch    string
+	expected string
+	valid    bool
+}{
+	{ // exact position
+		orig:     "a\nb\nc\n",
+		patch:    "@@ -1,3 +1,3 @@\n a\n-b\n+B\n c\n",
+		expected: "a\nB\nc\n",
+		valid:    true,
+	},
+	{ // offset by lines added before the hunk
+		orig:     "x\ny\na\nb\nc\n",
+		patch:    "@@ -1,3 +1,3 @@\n a\n-b\n+B\n c\n",
+		expected: "x\ny\na\nB\nc\n",
+		valid:    true,
+	},
+	{ // multiple hunks, insertion and deletion
+		orig:     "1\n2\n3\n4\n5\n6\n7\n8\n",
+		patch:    "@@ -1,2 +1,3 @@\n 1\n+1.5\n 2\n@@ -6,3 +7,2 @@\n 6\n-7\n 8\n",
+		expected: "1\n1.5\n2\n3\n4\n5\n6\n8\n",
+		valid:    true,
+	},
+	{ // no newline at end of file
+		orig:     "a\nb",
+		patch:    "@@ -1,2 +1,2 @@\n a\n-b\n\\ No newline at end of file\n+b\n",
+		expected: "a\nb\n",
+		valid:    true,
+	},
+	{ // new file
+		orig:     "",
+		patch:    "@@ -0,0 +1,2 @@\n+a\n+b\n",
+		expected: "a\nb\n",
+		valid:    true,
+	},
+	{ // context does not match
+		orig:  "a\nb\nc\n",
+		patch: "@@ -1,3 +1,3 @@\n a\n-x\n+B\n c\n",
+		valid: false,
+	},
+}
+
+func TestApplyHunks(t *testing.T) {
+	for i, test := range applyHunksTests {
+		patches, err := parsePatch(strings.NewReader("--- a/f\n+++ b/f\n" + test.patch))
+		if err != nil {
+			t.Fatalf("test(%v): unexpected error parsing patch: %v", i, err)
+		}
+		result, err := applyHunks(splitLines(test.orig), patches[0].hunks)
+		if expected, actual := test.valid, err == nil; expected != actual {
+			t.Fatalf("test(%v): valid: expected=%v actual=%v", i, expected, err)
+		}
+		if expected, actual := test.expected, strings.Join(result, ""); test.valid && expected != actual {
+			t.Fatalf("test(%v): expected=%q actual=%q", i, expected, actual)
+		}
+	}
+}
+
+func TestApplyPatch_CreatesModifiesAndDeletesFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "debrepo")
+	if err != nil {
+		t.Fatalf("unexpected error creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	ioutil.WriteFile(filepath.Join(dir, "modify"), []byte("a\nb\n"), 0755)
+	ioutil.WriteFile(filepath.Join(dir, "delete"), []byte("x\n"), 0644)
+	patch := `Description: example patch
+ with a description
+Index: pkg/modify
+===================================================================
+--- pkg.orig/modify	2016-01-01 00:00:00.000000000 +0000
++++ pkg/modify	2016-01-01 00:00:00.000000000 +0000
+@@ -1,2 +1,2 @@
+-a
++--- not a header
+ b
+--- /dev/null
++++ pkg/sub/create
+@@ -0,0 +1 @@
++new
+--- pkg.orig/delete
++++ /dev/null
+@@ -1 +0,0 @@
+-x
+`
+	if err := applyPatch(dir, bytes.NewBufferString(patch), 1); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if b, _ := ioutil.ReadFile(filepath.Join(dir, "modify")); string(b) != "--- not a header\nb\n" {
+		t.Fatalf("modify: unexpected contents: %q", b)
+	}
+	if fi, _ := os.Stat(filepath.Join(dir, "modify")); fi.Mode().Perm() != 0755 {
+		t.Fatalf("modify: expected mode to be kept, was: %v", fi.Mode())
+	}
+	if b, _ := ioutil.ReadFile(filepath.Join(dir, "sub", "create")); string(b) != "new\n" {
+		t.Fatalf("create: unexpected contents: %q", b)
+	}
+	if _, err := os.Lstat(filepath.Join(dir, "delete")); !os.IsNotExist(err) {
+		t.Fatalf("delete: expected file to be removed, got: %v", err)
+	}
+}
@@ -0,0 +1,434 @@
+package debrepo
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// RelationOp is a version relation operator used in package relationship
+// fields.
+type RelationOp string
+
+// Version relation operators. The obsolete forms "<" and ">" are parsed as
+// RelationLessEqual and RelationGreaterEqual, matching dpkg.
+const (
+	RelationLess         RelationOp = "<<"
+	RelationLessEqual    RelationOp = "<="
+	RelationEqual        RelationOp = "="
+	RelationGreaterEqual RelationOp = ">="
+	RelationGreater      RelationOp = ">>"
+)
+
+// Compare reports whether version v satisfies the relation op constraint.
+func (op RelationOp) Compare(v, constraint Version) bool {
+	c := v.Compare(constraint)
+	switch op {
+	case RelationLess:
+		return c < 0
+	case RelationLessEqual:
+		return c <= 0
+	case RelationEqual:
+		return c == 0
+	case RelationGreaterEqual:
+		return c >= 0
+	case RelationGreater:
+		return c > 0
+	}
+	return false
+}
+
+// RestrictionTerm is a term in an architecture restriction list or a build
+// profile restriction list. Negated terms are prefixed with '!'.
+type RestrictionTerm struct {
+	Name    string
+	Negated bool
+}
+
+func (t RestrictionTerm) String() string {
+	if t.Negated {
+		return "!" + t.Name
+	}
+	return t.Name
+}
+
+// Relation is a single package reference in a relationship field, such as
+// "libc6:any (>= 2.17) [amd64 arm64] <!nocheck>".
+//
+// ArchQualifier holds the multiarch qualifier following a ':' ("any",
+// "native" or an architecture name). Op and Version are set when the relation
+// has a version constraint. Architectures and Profiles hold the architecture
+// restriction list and build profile restriction formula used in source
+// package build relationships. Profiles is a disjunction of restriction lists
+// whose terms must all hold.
+type Relation struct {
+	Name          string
+	ArchQualifier string
+	Op            RelationOp
+	Version       Version
+	Architectures []RestrictionTerm
+	Profiles      [][]RestrictionTerm
+}
+
+// Alternatives is a list of relations separated by '|' of which any one
+// satisfies the dependency.
+type Alternatives []Relation
+
+// Dependencies is a parsed relationship field. Every element must be
+// satisfied.
+type Dependencies []Alternatives
+
+// ParseDependencies parses the value of a relationship field such as Depends,
+// Pre-Depends, Recommends, Conflicts, Breaks or Build-Depends. Empty elements
+// between commas are ignored.
+func ParseDependencies(s string) (Dependencies, error) {
+	var deps Dependencies
+	for _, group := range strings.Split(s, ",") {
+		if len(strings.TrimSpace(group)) == 0 {
+			continue
+		}
+		var alts Alternatives
+		for _, rel := range strings.Split(group, "|") {
+			r, err := ParseRelation(rel)
+			if err != nil {
+				return nil, err
+			}
+			alts = append(alts, r)
+		}
+		deps = append(deps, alts)
+	}
+	return deps, nil
+}
+
+// ParseRelation parses a single package reference from a relationship field.
+func ParseRelation(s string) (Relation, error) {
+	p := &relationParser{s: s}
+	r, err := p.parse()
+	if err != nil {
+		return Relation{}, errors.Wrapf(err, "invalid relation %q", strings.TrimSpace(s))
+	}
+	return r, nil
+}
+
+type relationParser struct {
+	s   string
+	pos int
+}
+
+func (p *relationParser) parse() (Relation, error) {
+	var r Relation
+	p.skipSpace()
+	r.Name = p.readWord(":([<")
+	if len(r.Name) == 0 {
+		return r, errors.New("missing package name")
+	}
+	p.skipSpace()
+	if p.consume(':') {
+		p.skipSpace()
+		r.ArchQualifier = p.readWord("([<")
+		if len(r.ArchQualifier) == 0 {
+			return r, errors.New("missing architecture qualifier")
+		}
+		p.skipSpace()
+	}
+	if p.consume('(') {
+		if err := p.parseVersion(&r); err != nil {
+			return r, err
+		}
+		p.skipSpace()
+	}
+	if p.consume('[') {
+		terms, err := p.parseTerms(']')
+		if err != nil {
+			return r, err
+		}
+		r.Architectures = terms
+		p.skipSpace()
+	}
+	for p.consume('<') {
+		terms, err := p.parseTerms('>')
+		if err != nil {
+			return r, err
+		}
+		r.Profiles = append(r.Profiles, terms)
+		p.skipSpace()
+	}
+	if p.pos < len(p.s) {
+		return r, errors.Errorf("unexpected character %q", p.s[p.pos])
+	}
+	return r, nil
+}
+
+func (p *relationParser) parseVersion(r *Relation) error {
+	p.skipSpace()
+	start := p.pos
+	for p.pos < len(p.s) && strings.IndexByte("<>=", p.s[p.pos]) >= 0 {
+		p.pos++
+	}
+	switch op := p.s[start:p.pos]; op {
+	case "<<", "<=", "=", ">=", ">>":
+		r.Op = RelationOp(op)
+	case "<":
+		r.Op = RelationLessEqual
+	case ">":
+		r.Op = RelationGreaterEqual
+	default:
+		return errors.Errorf("invalid version relation %q", op)
+	}
+	p.skipSpace()
+	end := strings.IndexByte(p.s[p.pos:], ')')
+	if end < 0 {
+		return errors.New("missing closing parenthesis")
+	}
+	v, err := ParseVersion(p.s[p.pos : p.pos+end])
+	if err != nil {
+		return err
+	}
+	r.Version = v
+	p.pos += end + 1
+	return nil
+}
+
+// parseTerms parses a whitespace separated restriction list up to the closing
+// delimiter.
+func (p *relationParser) parseTerms(closing byte) ([]RestrictionTerm, error) {
+	var terms []RestrictionTerm
+	for {
+		p.skipSpace()
+		if p.pos >= len(p.s) {
+			return nil, errors.Errorf("missing closing %q", closing)
+		}
+		if p.consume(closing) {
+			break
+		}
+		var t RestrictionTerm
+		if p.consume('!') {
+			t.Negated = true
+		}
+		t.Name = p.readWord(string(closing))
+		if len(t.Name) == 0 {
+			return nil, errors.New("empty restriction term")
+		}
+		terms = append(terms, t)
+	}
+	if len(terms) == 0 {
+		return nil, errors.New("empty restriction list")
+	}
+	return terms, nil
+}
+
+// readWord reads characters up to whitespace or one of the delimiters.
+func (p *relationParser) readWord(delims string) string {
+	start := p.pos
+	for p.pos < len(p.s) && !isSpace(p.s[p.pos]) && strings.IndexByte(delims, p.s[p.pos]) < 0 {
+		p.pos++
+	}
+	return p.s[start:p.pos]
+}
+
+func (p *relationParser) consume(c byte) bool {
+	if p.pos < len(p.s) && p.s[p.pos] == c {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *relationParser) skipSpace() {
+	for p.pos < len(p.s) && isSpace(p.s[p.pos]) {
+		p.pos++
+	}
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r'
+}
+
+// String returns the relation in the form used in control files.
+func (r Relation) String() string {
+	s := r.Name
+	if len(r.ArchQualifier) != 0 {
+		s += ":" + r.ArchQualifier
+	}
+	if len(r.Op) != 0 {
+		s += " (" + string(r.Op) + " " + r.Version.String() + ")"
+	}
+	if len(r.Architectures) != 0 {
+		s += " [" + joinTerms(r.Architectures) + "]"
+	}
+	for _, profiles := range r.Profiles {
+		s += " <" + joinTerms(profiles) + ">"
+	}
+	return s
+}
+
+func (a Alternatives) String() string {
+	ss := make([]string, len(a))
+	for i, r := range a {
+		ss[i] = r.String()
+	}
+	return strings.Join(ss, " | ")
+}
+
+func (d Dependencies) String() string {
+	ss := make([]string, len(d))
+	for i, a := range d {
+		ss[i] = a.String()
+	}
+	return strings.Join(ss, ", ")
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (d Dependencies) MarshalText() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler. See ParseDependencies.
+func (d *Dependencies) UnmarshalText(text []byte) error {
+	deps, err := ParseDependencies(string(text))
+	if err != nil {
+		return err
+	}
+	*d = deps
+	return nil
+}
+
+func joinTerms(terms []RestrictionTerm) string {
+	ss := make([]string, len(terms))
+	for i, t := range terms {
+		ss[i] = t.String()
+	}
+	return strings.Join(ss, " ")
+}
+
+// Satisfies reports whether pkg satisfies the relation, either directly or
+// through its Provides field. A versioned relation is only satisfied by a
+// provided package if the Provides entry is versioned. An ArchQualifier of
+// "any" requires pkg to be Multi-Arch allowed or foreign; any other qualifier
+// except "native" requires pkg to be of that architecture.
+func (r Relation) Satisfies(pkg *Package) bool {
+	if pkg == nil || !r.satisfiesArch(pkg) {
+		return false
+	}
+	if pkg.Package == r.Name {
+		if len(r.Op) == 0 {
+			return true
+		}
+		v, err := ParseVersion(pkg.Version)
+		return err == nil && r.Op.Compare(v, r.Version)
+	}
+	for _, alts := range pkg.Provides {
+		for _, p := range alts {
+			if p.Name != r.Name {
+				continue
+			}
+			if len(r.Op) == 0 {
+				return true
+			}
+			if p.Op == RelationEqual && r.Op.Compare(p.Version, r.Version) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (r Relation) satisfiesArch(pkg *Package) bool {
+	switch r.ArchQualifier {
+	case "", "native":
+		return true
+	case "any":
+		return pkg.MultiArch == "allowed" || pkg.MultiArch == "foreign"
+	}
+	return pkg.Architecture == r.ArchQualifier
+}
+
+// AppliesTo reports whether the relation is active when building for arch
+// with the build profiles in profiles enabled.
+func (r Relation) AppliesTo(arch string, profiles []string) bool {
+	if len(r.Architectures) != 0 {
+		// Restriction lists are either all negated or all positive.
+		matched := false
+		for _, t := range r.Architectures {
+			if archMatches(arch, t.Name) {
+				matched = true
+				break
+			}
+		}
+		if matched == r.Architectures[0].Negated {
+			return false
+		}
+	}
+	if len(r.Profiles) == 0 {
+		return true
+	}
+	for _, list := range r.Profiles {
+		if profilesMatch(list, profiles) {
+			return true
+		}
+	}
+	return false
+}
+
+func profilesMatch(list []RestrictionTerm, profiles []string) bool {
+	for _, t := range list {
+		enabled := false
+		for _, p := range profiles {
+			if p == t.Name {
+				enabled = true
+				break
+			}
+		}
+		if enabled == t.Negated {
+			return false
+		}
+	}
+	return true
+}
+
+// archMatches reports whether arch matches the architecture name or wildcard
+// pattern such as "any", "linux-any" or "any-amd64".
+func archMatches(arch, pattern string) bool {
+	if arch == pattern || pattern == "any" {
+		return true
+	}
+	os, cpu := "linux", arch
+	if i := strings.LastIndexByte(arch, '-'); i >= 0 {
+		os, cpu = arch[:i], arch[i+1:]
+	}
+	if strings.HasSuffix(pattern, "-any") {
+		return os == strings.TrimSuffix(pattern, "-any")
+	}
+	if strings.HasPrefix(pattern, "any-") {
+		return cpu == strings.TrimPrefix(pattern, "any-")
+	}
+	return false
+}
+
+// Reduce returns the dependencies which apply when building for arch with the
+// build profiles in profiles enabled. Alternatives left empty are dropped.
+func (d Dependencies) Reduce(arch string, profiles []string) Dependencies {
+	var reduced Dependencies
+	for _, alts := range d {
+		var a Alternatives
+		for _, r := range alts {
+			if r.AppliesTo(arch, profiles) {
+				a = append(a, r)
+			}
+		}
+		if len(a) != 0 {
+			reduced = append(reduced, a)
+		}
+	}
+	return reduced
+}
+
+// Satisfies reports whether any of the alternatives is satisfied by pkg.
+func (a Alternatives) Satisfies(pkg *Package) bool {
+	for _, r := range a {
+		if r.Satisfies(pkg) {
+			return true
+		}
+	}
+	return false
+}
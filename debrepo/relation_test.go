@@ -0,0 +1,170 @@
+package debrepo
+
+import (
+	"reflect"
+	"testing"
+)
+
+var parseDependenciesTests = []struct {
+	input    string
+	expected Dependencies
+	valid    bool
+}{
+	{
+		input: "libc6 (>= 2.17) | libc6-compat [amd64 arm64] <!nocheck>, foo:any",
+		expected: Dependencies{
+			{
+				{Name: "libc6", Op: RelationGreaterEqual, Version: Version{Upstream: "2.17"}},
+				{
+					Name:          "libc6-compat",
+					Architectures: []RestrictionTerm{{Name: "amd64"}, {Name: "arm64"}},
+					Profiles:      [][]RestrictionTerm{{{Name: "nocheck", Negated: true}}},
+				},
+			},
+			{{Name: "foo", ArchQualifier: "any"}},
+		},
+		valid: true,
+	},
+	{
+		input: "python3:native(>>3.5~), debhelper (= 1:9-2) <!stage1 cross> <pkg.foo.bar>",
+		expected: Dependencies{
+			{{Name: "python3", ArchQualifier: "native", Op: RelationGreater, Version: Version{Upstream: "3.5~"}}},
+			{{
+				Name:     "debhelper",
+				Op:       RelationEqual,
+				Version:  Version{Epoch: 1, Upstream: "9", Revision: "2"},
+				Profiles: [][]RestrictionTerm{{{Name: "stage1", Negated: true}, {Name: "cross"}}, {{Name: "pkg.foo.bar"}}},
+			}},
+		},
+		valid: true,
+	},
+	{
+		input: "a (<< 1), b (<= 1), c (< 1), d (> 1),\n e [!i386 !linux-any],",
+		expected: Dependencies{
+			{{Name: "a", Op: RelationLess, Version: Version{Upstream: "1"}}},
+			{{Name: "b", Op: RelationLessEqual, Version: Version{Upstream: "1"}}},
+			{{Name: "c", Op: RelationLessEqual, Version: Version{Upstream: "1"}}},
+			{{Name: "d", Op: RelationGreaterEqual, Version: Version{Upstream: "1"}}},
+			{{Name: "e", Architectures: []RestrictionTerm{{Name: "i386", Negated: true}, {Name: "linux-any", Negated: true}}}},
+		},
+		valid: true,
+	},
+	{input: "", expected: nil, valid: true},
+	{input: "a | , b", valid: false},
+	{input: "a (>= 1", valid: false},
+	{input: "a (~ 1)", valid: false},
+	{input: "a [amd64", valid: false},
+	{input: "a []", valid: false},
+	{input: "a <>", valid: false},
+	{input: "a:", valid: false},
+	{input: "a b", valid: false},
+}
+
+func TestParseDependencies(t *testing.T) {
+	for i, test := range parseDependenciesTests {
+		actual, err := ParseDependencies(test.input)
+		if expected, actual := test.valid, err == nil; expected != actual {
+			t.Fatalf("test(%v): valid: expected=%v actual=%v: %v", i, expected, actual, err)
+		}
+		if !test.valid {
+			continue
+		}
+		if !reflect.DeepEqual(test.expected, actual) {
+			t.Fatalf("test(%v):\nexpected=%+v\nactual=%+v", i, test.expected, actual)
+		}
+	}
+}
+
+func TestDependencies_String(t *testing.T) {
+	input := "libc6 (>= 2.17) | libc6-compat [amd64 arm64] <!nocheck>, foo:any, bar (= 1:2-3) <!stage1 cross> <nodoc>"
+	deps, err := ParseDependencies(input)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if expected, actual := input, deps.String(); expected != actual {
+		t.Fatalf("expected=%v actual=%v", expected, actual)
+	}
+}
+
+var relationSatisfiesTests = []struct {
+	relation string
+	pkg      *Package
+	expected bool
+}{
+	{"foo", &Package{Package: "foo", Version: "1.0"}, true},
+	{"foo", &Package{Package: "bar", Version: "1.0"}, false},
+	{"foo (>= 1.0)", &Package{Package: "foo", Version: "1.0"}, true},
+	{"foo (>> 1.0)", &Package{Package: "foo", Version: "1.0"}, false},
+	{"foo (<< 1.0)", &Package{Package: "foo", Version: "1.0~rc1"}, true},
+	{"foo (<= 1.0)", &Package{Package: "foo", Version: "1:0.1"}, false},
+	{"foo (= 1.0-1)", &Package{Package: "foo", Version: "1.0-1"}, true},
+	{"foo", &Package{Package: "bar", Provides: mustParseDependencies("foo")}, true},
+	{"foo (>= 1)", &Package{Package: "bar", Provides: mustParseDependencies("foo")}, false},
+	{"foo (>= 1)", &Package{Package: "bar", Provides: mustParseDependencies("foo (= 2)")}, true},
+	{"foo (>= 3)", &Package{Package: "bar", Provides: mustParseDependencies("foo (= 2)")}, false},
+	{"foo:any", &Package{Package: "foo", MultiArch: "allowed"}, true},
+	{"foo:any", &Package{Package: "foo"}, false},
+	{"foo:amd64", &Package{Package: "foo", Architecture: "amd64"}, true},
+	{"foo:amd64", &Package{Package: "foo", Architecture: "i386"}, false},
+	{"foo:native", &Package{Package: "foo", Architecture: "i386"}, true},
+}
+
+func TestRelation_Satisfies(t *testing.T) {
+	for i, test := range relationSatisfiesTests {
+		r, err := ParseRelation(test.relation)
+		if err != nil {
+			t.Fatalf("test(%v): unexpected error: %v", i, err)
+		}
+		if expected, actual := test.expected, r.Satisfies(test.pkg); expected != actual {
+			t.Fatalf("test(%v): %s: expected=%v actual=%v", i, test.relation, expected, actual)
+		}
+	}
+}
+
+var relationAppliesToTests = []struct {
+	relation string
+	arch     string
+	profiles []string
+	expected bool
+}{
+	{"foo", "amd64", nil, true},
+	{"foo [amd64 arm64]", "amd64", nil, true},
+	{"foo [amd64 arm64]", "i386", nil, false},
+	{"foo [!amd64]", "amd64", nil, false},
+	{"foo [!amd64]", "i386", nil, true},
+	{"foo [linux-any]", "amd64", nil, true},
+	{"foo [linux-any]", "kfreebsd-amd64", nil, false},
+	{"foo [any-amd64]", "kfreebsd-amd64", nil, true},
+	{"foo <!nocheck>", "amd64", nil, true},
+	{"foo <!nocheck>", "amd64", []string{"nocheck"}, false},
+	{"foo <stage1 cross>", "amd64", []string{"stage1"}, false},
+	{"foo <stage1 cross>", "amd64", []string{"stage1", "cross"}, true},
+	{"foo <stage1> <cross>", "amd64", []string{"cross"}, true},
+}
+
+func TestRelation_AppliesTo(t *testing.T) {
+	for i, test := range relationAppliesToTests {
+		r, err := ParseRelation(test.relation)
+		if err != nil {
+			t.Fatalf("test(%v): unexpected error: %v", i, err)
+		}
+		if expected, actual := test.expected, r.AppliesTo(test.arch, test.profiles); expected != actual {
+			t.Fatalf("test(%v): %s: expected=%v actual=%v", i, test.relation, expected, actual)
+		}
+	}
+}
+
+func TestDependencies_Reduce(t *testing.T) {
+	deps := mustParseDependencies("a [amd64] | b, c [i386], d <!nocheck>")
+	if expected, actual := "a [amd64] | b, d <!nocheck>", deps.Reduce("amd64", nil).String(); expected != actual {
+		t.Fatalf("expected=%v actual=%v", expected, actual)
+	}
+}
+
+func mustParseDependencies(s string) Dependencies {
+	deps, err := ParseDependencies(s)
+	if err != nil {
+		panic(err)
+	}
+	return deps
+}
@@ -9,6 +9,8 @@ import (
 	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
 	"io/ioutil"
 
@@ -27,17 +29,32 @@ var (
 
 // Release fields corresponding to the release file table.
 const (
-	ReleaseFieldMD5Sum = "Md5sum"
-	ReleaseFieldSHA1   = "Sha1"
-	ReleaseFieldSHA256 = "Sha256"
+	ReleaseFieldMD5Sum = "MD5Sum"
+	ReleaseFieldSHA1   = "SHA1"
+	ReleaseFieldSHA256 = "SHA256"
+	ReleaseFieldSHA512 = "SHA512"
 )
 
+// releaseFileTables maps the Release fields containing file tables to the
+// hash function used by each.
+var releaseFileTables = []struct {
+	field string
+	hash  crypto.Hash
+}{
+	{ReleaseFieldMD5Sum, crypto.MD5},
+	{ReleaseFieldSHA1, crypto.SHA1},
+	{ReleaseFieldSHA256, crypto.SHA256},
+	{ReleaseFieldSHA512, crypto.SHA512},
+}
+
 // Release contains a listing of index files for the distribution and their
 // associated hashes.
 type Release clearsign.Block
 
 // GetRelease downloads the release file and its associated signature file.
-// If client is nil, http.DefaultClient is used.
+// If client is nil, http.DefaultClient is used. The signature is not checked;
+// use Release.CheckRepositorySignature with repo to honour its signed-by
+// option.
 func GetRelease(ctx context.Context, client *http.Client, repo *Repository) (*Release, error) {
 	// prevent race conditions during testing
 	testhookGetReleaseFromInRelease := testhookGetReleaseFromInRelease
@@ -90,15 +107,23 @@ func GetRelease(ctx context.Context, client *http.Client, repo *Repository) (*Re
 
 // CheckSignature returns the signer of the release file if it is valid. If the
 // signer isn't known, ErrUnknownIssuer (golang.org/x/crypto/openpgp/errors) is
-// returned.
+// returned. A correctly signed release file is still rejected if it fails
+// the freshness checks of the zero FreshnessPolicy, such as having a
+// Valid-Until date in the past. Use CheckFreshness to apply a stricter policy.
+//
+// Any key in keyring is trusted, even if the repository the Release file came
+// from is restricted to other keys with signed-by. Use
+// CheckRepositorySignature to honour signed-by, as Client does, and Verify to
+// inspect every signature.
 func (r *Release) CheckSignature(keyring openpgp.KeyRing) (signer *openpgp.Entity, err error) {
-	var b *bytes.Buffer
-	if len(r.Bytes) > 0 {
-		b = bytes.NewBuffer(r.Bytes)
-	} else {
-		b = bytes.NewBuffer(r.Plaintext)
+	result, err := r.Verify(keyring, SignaturePolicy{})
+	if err != nil {
+		return nil, err
 	}
-	return openpgp.CheckDetachedSignature(keyring, b, r.ArmoredSignature.Body)
+	if err := r.CheckFreshness(FreshnessPolicy{}); err != nil {
+		return nil, err
+	}
+	return result.Valid()[0].Signer, nil
 }
 
 // ReadFields reads the key/value fields from the Release file.
@@ -106,10 +131,100 @@ func (r *Release) ReadFields() (Fields, error) {
 	return ReadFields(r.Plaintext)
 }
 
+// ReleaseInfo is the metadata describing a distribution read from its Release
+// file. Times are zero if the corresponding field is not present.
+type ReleaseInfo struct {
+	Origin               string
+	Label                string
+	Suite                string
+	Codename             string
+	Version              string
+	Description          string
+	Date                 time.Time
+	ValidUntil           time.Time
+	Architectures        []string
+	Components           []string
+	AcquireByHash        bool
+	NotAutomatic         bool
+	ButAutomaticUpgrades bool
+	SignedBy             []string
+}
+
+// ReadInfo returns the distribution metadata from the Release file. Boolean
+// fields accept the values apt does, such as "yes", "true" and "1"; other
+// values are returned as a *ParseError.
+func (r *Release) ReadInfo() (*ReleaseInfo, error) {
+	fields, err := r.ReadFields()
+	if err != nil {
+		return nil, err
+	}
+	info := &ReleaseInfo{
+		Origin:        fields.Get("Origin"),
+		Label:         fields.Get("Label"),
+		Suite:         fields.Get("Suite"),
+		Codename:      fields.Get("Codename"),
+		Version:       fields.Get("Version"),
+		Description:   fields.Get("Description"),
+		Architectures: strings.Fields(fields.Get("Architectures")),
+		Components:    strings.Fields(fields.Get("Components")),
+		SignedBy:      splitOptionValues(fields.Get("Signed-By")),
+	}
+	bools := []struct {
+		field string
+		dst   *bool
+	}{
+		{"Acquire-By-Hash", &info.AcquireByHash},
+		{"NotAutomatic", &info.NotAutomatic},
+		{"ButAutomaticUpgrades", &info.ButAutomaticUpgrades},
+	}
+	for _, b := range bools {
+		v, ok := fields.Lookup(b.field)
+		if !ok {
+			continue
+		}
+		if *b.dst, err = parseAptBool(v); err != nil {
+			return nil, &ParseError{Line: fieldLine(r.Plaintext, b.field), Err: fmt.Errorf("%s field: %v", b.field, err)}
+		}
+	}
+	if v := fields.Get("Date"); len(v) != 0 {
+		if info.Date, err = parseReleaseDate(v); err != nil {
+			return nil, err
+		}
+	}
+	if v := fields.Get("Valid-Until"); len(v) != 0 {
+		if info.ValidUntil, err = parseReleaseDate(v); err != nil {
+			return nil, err
+		}
+	}
+	return info, nil
+}
+
+// releaseDateLayouts are the RFC 2822 date formats accepted in Release files.
+var releaseDateLayouts = []string{
+	"Mon, 2 Jan 2006 15:04:05 MST",
+	"Mon, 2 Jan 2006 15:04:05 -0700",
+	"Mon, 2 Jan 2006 15:04:05 -0700 (MST)",
+	"2 Jan 2006 15:04:05 MST",
+	"2 Jan 2006 15:04:05 -0700",
+}
+
+// parseReleaseDate parses an RFC 2822 date from a Release file.
+func parseReleaseDate(v string) (time.Time, error) {
+	v = strings.TrimSpace(v)
+	for _, layout := range releaseDateLayouts {
+		if t, err := time.Parse(layout, v); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid date in release file: %s", v)
+}
+
 // ReadFileTable returns a map containing the index files present on the package
 // repository. The keys are the paths of the files relative to the directory of
-// the Release file. The values contain meta information describing which
-// checksum function was used, checksum value, and the file size.
+// the Release file. The values contain every checksum listed for the file in
+// the MD5Sum, SHA1, SHA256 and SHA512 fields, and the file size. Missing
+// fields are skipped; an error is returned if none are present or a file is
+// listed with different sizes.
 func (r *Release) ReadFileTable() (map[string]FileMeta, error) {
 	fields, err := r.ReadFields()
 	if err != nil {
@@ -117,11 +232,19 @@ func (r *Release) ReadFileTable() (map[string]FileMeta, error) {
 	}
 
 	fileTable := make(map[string]FileMeta)
-	err = parseFileTable(fileTable, fields[ReleaseFieldMD5Sum][0], crypto.MD5)
-	err = parseFileTable(fileTable, fields[ReleaseFieldSHA1][0], crypto.SHA1)
-	err = parseFileTable(fileTable, fields[ReleaseFieldSHA256][0], crypto.SHA256)
-	if err != nil {
-		return nil, err
+	found := false
+	for _, t := range releaseFileTables {
+		table, ok := fields.Lookup(t.field)
+		if !ok {
+			continue
+		}
+		found = true
+		if err := parseFileTable(fileTable, table, t.hash); err != nil {
+			return nil, fmt.Errorf("%s field: %v", t.field, err)
+		}
+	}
+	if !found {
+		return nil, errors.New("no file table in release file")
 	}
 	return fileTable, nil
 }
@@ -152,11 +275,15 @@ func parseFileTable(fileTable map[string]FileMeta, table string, hash crypto.Has
 			return errors.New("missing file name in release file table")
 		}
 		filepath := scanner.Text()
-		fileTable[filepath] = FileMeta{
-			HashSum: hashBytes,
-			Hash:    hash,
-			Size:    size,
+		meta, ok := fileTable[filepath]
+		if !ok {
+			meta = FileMeta{Size: size, Hashes: make(map[crypto.Hash][]byte)}
+		} else if meta.Size != size {
+			return fmt.Errorf("conflicting sizes for %s in release file table", filepath)
 		}
+		meta.Hashes[hash] = hashBytes
+		meta.Hash, meta.HashSum, _ = meta.StrongestHash(true)
+		fileTable[filepath] = meta
 	}
 	if err := scanner.Err(); err != nil {
 		return err
@@ -4,7 +4,9 @@ import (
 	"crypto"
 	"encoding/hex"
 	"reflect"
+	"strings"
 	"testing"
+	"time"
 
 	"golang.org/x/net/context"
 )
@@ -91,7 +93,7 @@ func TestRelease_ReadFields(t *testing.T) {
 	if err != nil {
 		t.Fatalf("unexpected error reading fields: %v", err)
 	}
-	if expected, actual := "Ubuntu", fields["Origin"][0]; expected != actual {
+	if expected, actual := "Ubuntu", fields.Get("Origin"); expected != actual {
 		t.Fatalf("field Origin: expected=%v actual=%v", expected, actual)
 	}
 }
@@ -112,6 +114,64 @@ func TestRelease_ReadFileTable(t *testing.T) {
 	}
 }
 
+func TestRelease_ReadFileTable_MissingAndSHA512Fields(t *testing.T) {
+	tests := []struct {
+		release string
+		hashes  []crypto.Hash
+		valid   bool
+	}{
+		{ // no MD5Sum field, as in modern Debian Release files
+			release: "SHA256:\n" +
+				" 8d6ab57abf517d7712e4e4d23d762485af49f8140a83b221ea7282f82a51c795 1557985 main/binary-amd64/Packages.gz\n" +
+				"SHA512:\n" +
+				" " + strings.Repeat("ab", 64) + " 1557985 main/binary-amd64/Packages.gz\n",
+			hashes: []crypto.Hash{crypto.SHA256, crypto.SHA512},
+			valid:  true,
+		},
+		{
+			release: "MD5Sum:\n" +
+				" 7b7877be9dd6ac0e6b8baffbc36ce09c 1557985 main/binary-amd64/Packages.gz\n",
+			hashes: []crypto.Hash{crypto.MD5},
+			valid:  true,
+		},
+		{ // error in an earlier field is reported
+			release: "MD5Sum:\n" +
+				" 7b7877be9dd6ac0e6b8baffbc36ce09c Z1557985 main/binary-amd64/Packages.gz\n" +
+				"SHA256:\n" +
+				" 8d6ab57abf517d7712e4e4d23d762485af49f8140a83b221ea7282f82a51c795 1557985 main/binary-amd64/Packages.gz\n",
+			valid: false,
+		},
+		{ // conflicting sizes
+			release: "MD5Sum:\n" +
+				" 7b7877be9dd6ac0e6b8baffbc36ce09c 1 main/binary-amd64/Packages.gz\n" +
+				"SHA256:\n" +
+				" 8d6ab57abf517d7712e4e4d23d762485af49f8140a83b221ea7282f82a51c795 1557985 main/binary-amd64/Packages.gz\n",
+			valid: false,
+		},
+		{ // no file table
+			release: "Origin: Test\n",
+			valid:   false,
+		},
+	}
+	for i, test := range tests {
+		release := &Release{Plaintext: []byte(test.release)}
+		fileTable, err := release.ReadFileTable()
+		if expected, actual := test.valid, err == nil; expected != actual {
+			t.Fatalf("test(%v): valid: expected=%v actual=%v", i, expected, err)
+		}
+		if !test.valid {
+			continue
+		}
+		meta := fileTable["main/binary-amd64/Packages.gz"]
+		if expected, actual := len(test.hashes), len(meta.Hashes); expected != actual {
+			t.Fatalf("test(%v): expected=%v actual=%v", i, expected, actual)
+		}
+		if expected, actual := test.hashes[len(test.hashes)-1], meta.Hash; expected != actual {
+			t.Fatalf("test(%v): expected=%v actual=%v", i, expected, actual)
+		}
+	}
+}
+
 var parseFileTableTests = []struct {
 	table     string
 	fileTable map[string]FileMeta
@@ -125,11 +185,17 @@ var parseFileTableTests = []struct {
 				HashSum: decodeHexString("974c021c888f99cdfe9562e5f952484a"),
 				Hash:    crypto.MD5,
 				Size:    1194721,
+				Hashes: map[crypto.Hash][]byte{
+					crypto.MD5: decodeHexString("974c021c888f99cdfe9562e5f952484a"),
+				},
 			},
 			"contrib/Contents-amd64.gz": FileMeta{
 				HashSum: decodeHexString("450dd45dc5f77c017ef8dd3dd7bc0f8c"),
 				Hash:    crypto.MD5,
 				Size:    88515,
+				Hashes: map[crypto.Hash][]byte{
+					crypto.MD5: decodeHexString("450dd45dc5f77c017ef8dd3dd7bc0f8c"),
+				},
 			},
 		},
 		valid: true,
@@ -183,3 +249,98 @@ func decodeHexString(h string) []byte {
 	b, _ := hex.DecodeString(h)
 	return b
 }
+
+func TestRelease_ReadInfo(t *testing.T) {
+	tr := NewTestRepository()
+	defer tr.Close()
+	release, _ := GetRelease(context.Background(), nil, tr.Repository())
+	info, err := release.ReadInfo()
+	if err != nil {
+		t.Fatalf("unexpected error reading info: %v", err)
+	}
+	expected := &ReleaseInfo{
+		Origin:        "Ubuntu",
+		Label:         "Ubuntu",
+		Suite:         "xenial",
+		Codename:      "xenial",
+		Version:       "16.04",
+		Description:   "Ubuntu Xenial 16.04",
+		Date:          time.Date(2016, time.April, 21, 23, 23, 46, 0, time.UTC),
+		Architectures: []string{"amd64", "arm64", "armhf", "i386", "powerpc", "ppc64el", "s390x"},
+		Components:    []string{"main", "restricted", "universe", "multiverse"},
+		AcquireByHash: true,
+		SignedBy:      []string{},
+	}
+	if !reflect.DeepEqual(expected, info) {
+		t.Fatalf("\nexpected=%+v\nactual=%+v", expected, info)
+	}
+}
+
+func TestRelease_ReadInfo_OptionalFields(t *testing.T) {
+	release := &Release{Plaintext: []byte(`Suite: experimental
+Date: Sat, 1 Oct 2016 08:21:38 +0000
+Valid-Until: Sat, 08 Oct 2016 08:21:38 UTC
+NotAutomatic: yes
+ButAutomaticUpgrades: yes
+Acquire-By-Hash: no
+Signed-By: 0123456789ABCDEF0123456789ABCDEF01234567, 89ABCDEF0123456789ABCDEF0123456789ABCDEF
+`)}
+	info, err := release.ReadInfo()
+	if err != nil {
+		t.Fatalf("unexpected error reading info: %v", err)
+	}
+	if expected, actual := time.Date(2016, time.October, 1, 8, 21, 38, 0, time.UTC), info.Date; !expected.Equal(actual) {
+		t.Fatalf("date: expected=%v actual=%v", expected, actual)
+	}
+	if expected, actual := time.Date(2016, time.October, 8, 8, 21, 38, 0, time.UTC), info.ValidUntil; !expected.Equal(actual) {
+		t.Fatalf("valid until: expected=%v actual=%v", expected, actual)
+	}
+	if !info.NotAutomatic || !info.ButAutomaticUpgrades || info.AcquireByHash {
+		t.Fatalf("unexpected boolean fields: %+v", info)
+	}
+	if expected, actual := 2, len(info.SignedBy); expected != actual {
+		t.Fatalf("signed by: expected=%v actual=%v", expected, actual)
+	}
+}
+
+func TestRelease_ReadInfo_BooleanFields(t *testing.T) {
+	tests := []struct {
+		value string
+		valid bool
+		set   bool
+	}{
+		{"yes", true, true},
+		{"true", true, true},
+		{"1", true, true},
+		{"no", true, false},
+		{"False", true, false},
+		{"maybe", false, false},
+	}
+	for i, test := range tests {
+		release := &Release{Plaintext: []byte("Suite: xenial\nAcquire-By-Hash: " + test.value + "\n")}
+		info, err := release.ReadInfo()
+		if !test.valid {
+			parseErr, ok := err.(*ParseError)
+			if !ok {
+				t.Fatalf("test(%v): expected *ParseError, got: %v", i, err)
+			}
+			if expected, actual := 2, parseErr.Line; expected != actual {
+				t.Fatalf("test(%v): line: expected=%v actual=%v", i, expected, actual)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("test(%v): unexpected error: %v", i, err)
+		}
+		if expected, actual := test.set, info.AcquireByHash; expected != actual {
+			t.Fatalf("test(%v): expected=%v actual=%v", i, expected, actual)
+		}
+	}
+}
+
+func TestRelease_ReadInfo_InvalidDate_ReturnsError(t *testing.T) {
+	release := &Release{Plaintext: []byte("Date: yesterday\n")}
+	if _, err := release.ReadInfo(); err == nil {
+		t.Fatal("expected error on invalid date")
+	}
+}
@@ -0,0 +1,152 @@
+package debrepo
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ErrReleaseRollback is returned when a repository serves a Release file
+// older than one previously accepted for the same distribution.
+const ErrReleaseRollback = Error("release file older than previously accepted release")
+
+// ReleaseState is the state recorded for the last Release file accepted for a
+// distribution.
+type ReleaseState struct {
+	Date   time.Time
+	SHA256 []byte
+}
+
+// ReleaseStateStore stores the state of the last accepted Release file for
+// each distribution. It is used by Client to reject Release files older than
+// one already accepted. Keys identify a repository's distribution.
+//
+// Get returns nil and no error if no state is stored for key.
+type ReleaseStateStore interface {
+	Get(key string) (*ReleaseState, error)
+	Put(key string, state *ReleaseState) error
+}
+
+// checkRollback returns ErrReleaseRollback if release is older than the state
+// stored for repo. Otherwise the state for repo is updated to release.
+func checkRollback(store ReleaseStateStore, repo *Repository, release []byte) error {
+	info, err := (&Release{Plaintext: release}).ReadInfo()
+	if err != nil {
+		return err
+	}
+	if info.Date.IsZero() {
+		return errors.New("cannot check for rollback: Release file has no Date field")
+	}
+	key := repo.stateKey()
+	prev, err := store.Get(key)
+	if err != nil {
+		return errors.Wrap(err, "failed to read release state")
+	}
+	if prev != nil && info.Date.Before(prev.Date) {
+		return errors.Wrapf(ErrReleaseRollback, "dated %s, previously accepted %s",
+			info.Date.Format(time.RFC1123), prev.Date.Format(time.RFC1123))
+	}
+	sum := sha256.Sum256(release)
+	if err := store.Put(key, &ReleaseState{Date: info.Date, SHA256: sum[:]}); err != nil {
+		return errors.Wrap(err, "failed to save release state")
+	}
+	return nil
+}
+
+// MemoryReleaseStateStore is a ReleaseStateStore held in memory.
+type MemoryReleaseStateStore struct {
+	mu     sync.Mutex
+	states map[string]ReleaseState
+}
+
+// NewMemoryReleaseStateStore returns an empty MemoryReleaseStateStore.
+func NewMemoryReleaseStateStore() *MemoryReleaseStateStore {
+	return &MemoryReleaseStateStore{states: make(map[string]ReleaseState)}
+}
+
+// Get returns the state stored for key.
+func (s *MemoryReleaseStateStore) Get(key string) (*ReleaseState, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	state, ok := s.states[key]
+	if !ok {
+		return nil, nil
+	}
+	return &state, nil
+}
+
+// Put stores state for key.
+func (s *MemoryReleaseStateStore) Put(key string, state *ReleaseState) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.states[key] = *state
+	return nil
+}
+
+// FileReleaseStateStore is a ReleaseStateStore persisted as a JSON file. The
+// file is rewritten atomically on each Put.
+type FileReleaseStateStore struct {
+	mu       sync.Mutex
+	filename string
+}
+
+// NewFileReleaseStateStore returns a FileReleaseStateStore saved to filename.
+// The file is created on the first Put if it does not exist.
+func NewFileReleaseStateStore(filename string) *FileReleaseStateStore {
+	return &FileReleaseStateStore{filename: filename}
+}
+
+// Get returns the state stored for key.
+func (s *FileReleaseStateStore) Get(key string) (*ReleaseState, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	states, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+	state, ok := states[key]
+	if !ok {
+		return nil, nil
+	}
+	return &state, nil
+}
+
+// Put stores state for key.
+func (s *FileReleaseStateStore) Put(key string, state *ReleaseState) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	states, err := s.load()
+	if err != nil {
+		return err
+	}
+	states[key] = *state
+	b, err := json.MarshalIndent(states, "", "\t")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(s.filename, func(w io.Writer) error {
+		_, err := w.Write(b)
+		return err
+	})
+}
+
+func (s *FileReleaseStateStore) load() (map[string]ReleaseState, error) {
+	states := make(map[string]ReleaseState)
+	b, err := ioutil.ReadFile(s.filename)
+	if os.IsNotExist(err) {
+		return states, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, &states); err != nil {
+		return nil, errors.Wrapf(err, "invalid release state file: %s", s.filename)
+	}
+	return states, nil
+}
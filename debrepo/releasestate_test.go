@@ -0,0 +1,52 @@
+package debrepo
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestReleaseStateStores_PutThenGet_ReturnsState(t *testing.T) {
+	dir, err := ioutil.TempDir("", "debrepo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "state.json")
+
+	state := &ReleaseState{
+		Date:   time.Date(2016, time.October, 1, 0, 0, 0, 0, time.UTC),
+		SHA256: []byte{1, 2, 3},
+	}
+	stores := []ReleaseStateStore{
+		NewMemoryReleaseStateStore(),
+		NewFileReleaseStateStore(filename),
+	}
+	for i, store := range stores {
+		if actual, err := store.Get("http://example.com/dists/xenial"); err != nil || actual != nil {
+			t.Fatalf("test(%v): expected=<nil> actual=%v err=%v", i, actual, err)
+		}
+		if err := store.Put("http://example.com/dists/xenial", state); err != nil {
+			t.Fatalf("test(%v): unexpected error: %v", i, err)
+		}
+		actual, err := store.Get("http://example.com/dists/xenial")
+		if err != nil {
+			t.Fatalf("test(%v): unexpected error: %v", i, err)
+		}
+		if actual == nil || !actual.Date.Equal(state.Date) || !bytes.Equal(actual.SHA256, state.SHA256) {
+			t.Fatalf("test(%v): expected=%v actual=%v", i, state, actual)
+		}
+	}
+
+	// A new store reading the same file sees the saved state.
+	actual, err := NewFileReleaseStateStore(filename).Get("http://example.com/dists/xenial")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if actual == nil || !actual.Date.Equal(state.Date) {
+		t.Fatalf("expected=%v actual=%v", state, actual)
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"path"
 	"strings"
 
+	"github.com/pkg/errors"
 	"golang.org/x/net/context"
 )
 
@@ -23,52 +24,122 @@ type RepositoryList []*Repository
 // Repository represents a Debian package repository.
 type Repository struct {
 	repoType     string
+	options      []RepositoryOption
 	baseURI      string
 	distribution string
 	components   []string
+	signedByKey  string
+}
+
+// RepositoryOption is an option set in the "[ ]" block of a sources.list
+// entry, such as "arch=amd64,i386" or "signed-by=/usr/share/keyrings/x.gpg".
+// Op is one of "=", "+=" or "-=".
+type RepositoryOption struct {
+	Key    string
+	Op     string
+	Values []string
+}
+
+func (o RepositoryOption) String() string {
+	return o.Key + o.Op + strings.Join(o.Values, ",")
 }
 
 // ParseRepository parses entry to create a Repository.
 // Entry must be in the format:
 // 	deb http://ftp.debian.org/debian squeeze main contrib non-free
+// An options block may follow the type:
+// 	deb [arch=amd64 trusted=yes] http://ftp.debian.org/debian squeeze main
+// See ParseSourcesList for parsing entire sources.list files.
 func ParseRepository(entry string) (*Repository, error) {
-	ss := strings.Split(entry, " ")
-	if len(ss) < 4 {
-		return nil, ErrInvalidRepository
-	}
-	for _, field := range ss {
-		if len(field) == 0 {
-			return nil, ErrInvalidRepository
-		}
-	}
-	if ss[0] != "deb" && ss[0] != "deb-src" {
-		return nil, ErrInvalidRepository
-	}
-	if !isURL(ss[1]) {
+	r, err := parseSourcesEntry(entry)
+	if err != nil || r == nil {
 		return nil, ErrInvalidRepository
 	}
-	return &Repository{
-		repoType:     ss[0],
-		baseURI:      ss[1],
-		distribution: ss[2],
-		components:   ss[3:],
-	}, nil
+	return r, nil
 }
 
 // String returns the value of Repository as a string in the form found in a
 // source.list file:
 // 	deb http://ftp.debian.org/debian squeeze main contrib non-free
 func (r Repository) String() string {
-	if len(r.components) == 0 {
+	if r.isZero() {
 		return ""
 	}
+	repoType := r.repoType
+	if len(r.options) != 0 {
+		options := make([]string, len(r.options))
+		for i, o := range r.options {
+			options[i] = o.String()
+		}
+		repoType += " [" + strings.Join(options, " ") + "]"
+	}
+	if r.IsFlat() {
+		return fmt.Sprintf("%s %s %s", repoType, r.baseURI, r.distribution)
+	}
 	return fmt.Sprintf("%s %s %s %s",
-		r.repoType,
+		repoType,
 		r.baseURI,
 		r.distribution,
 		strings.Join(r.components, " "))
 }
 
+// IsFlat returns true if the repository is a flat repository. Flat
+// repositories have a distribution ending in "/", such as "./", and no
+// components. Their Release and Packages files are found directly in the
+// distribution directory relative to the base URI rather than under "dists/".
+func (r Repository) IsFlat() bool {
+	return strings.HasSuffix(r.distribution, "/")
+}
+
+// IsSource returns true if the repository is a "deb-src" entry providing
+// source packages. Source repositories list Sources indexes rather than
+// Packages indexes. See Client.GetSourceIndexes.
+func (r Repository) IsSource() bool {
+	return r.repoType == "deb-src"
+}
+
+// Options returns the options set on the repository entry.
+func (r Repository) Options() []RepositoryOption {
+	options := make([]RepositoryOption, len(r.options))
+	copy(options, r.options)
+	return options
+}
+
+// SignedByKey returns the ASCII-armored key block given inline in the
+// Signed-By field of a deb822-style sources file. It returns an empty string
+// if no inline key was given. Inline keys cannot be represented by the
+// one-line style and are omitted by String.
+func (r Repository) SignedByKey() string {
+	return r.signedByKey
+}
+
+// Option returns the values of the last option set with key using "=". It
+// returns nil if the option is not set.
+func (r Repository) Option(key string) []string {
+	var values []string
+	for _, o := range r.options {
+		if o.Key == key && o.Op == "=" {
+			values = o.Values
+		}
+	}
+	return values
+}
+
+// validateComponents returns an error if the repository has no components or
+// is a flat repository with components.
+func (r Repository) validateComponents() error {
+	if r.IsFlat() {
+		if len(r.components) != 0 {
+			return errors.Wrap(ErrInvalidRepository, "components given for flat repository")
+		}
+		return nil
+	}
+	if len(r.components) == 0 {
+		return errors.Wrap(ErrInvalidRepository, "missing components")
+	}
+	return nil
+}
+
 // isZero returns true if Repository is empty.
 func (r Repository) isZero() bool {
 	return len(r.baseURI) == 0
@@ -76,31 +147,51 @@ func (r Repository) isZero() bool {
 
 // InReleaseURL returns the URL to the repository's InRelease file.
 func (r Repository) InReleaseURL() string {
-	u, err := url.Parse(r.baseURI)
-	if err != nil {
-		panic(err)
-	}
-	u.Path = path.Join(u.Path, "dists", r.distribution, "InRelease")
-	return u.String()
+	return r.distURL("InRelease")
 }
 
 // ReleaseURL returns the URL to the repository's InRelease file.
 func (r Repository) ReleaseURL() string {
+	return r.distURL("Release")
+}
+
+// ReleaseGPGURL returns the URL to the repository's Release.gpg file.
+func (r Repository) ReleaseGPGURL() string {
+	return r.distURL("Release.gpg")
+}
+
+// distURL returns the URL to a file in the repository's distribution
+// directory. Paths listed in the Release file table are relative to this
+// directory. For flat repositories the distribution directory is relative to
+// the base URI instead of "dists/".
+func (r Repository) distURL(filepath string) string {
 	u, err := url.Parse(r.baseURI)
 	if err != nil {
 		panic(err)
 	}
-	u.Path = path.Join(u.Path, "dists", r.distribution, "Release")
+	if r.IsFlat() {
+		u.Path = path.Join(u.Path, r.distribution, filepath)
+	} else {
+		u.Path = path.Join(u.Path, "dists", r.distribution, filepath)
+	}
 	return u.String()
 }
 
-// ReleaseGPGURL returns the URL to the repository's Release.gpg file.
-func (r Repository) ReleaseGPGURL() string {
+// stateKey returns the key identifying the repository's distribution in a
+// ReleaseStateStore.
+func (r Repository) stateKey() string {
+	return r.distURL("")
+}
+
+// fileURL returns the URL to a file referenced by a Filename field in a
+// package index. These paths are relative to the repository's base URI, for
+// flat repositories as well.
+func (r Repository) fileURL(filepath string) string {
 	u, err := url.Parse(r.baseURI)
 	if err != nil {
 		panic(err)
 	}
-	u.Path = path.Join(u.Path, "dists", r.distribution, "Release.gpg")
+	u.Path = path.Join(u.Path, filepath)
 	return u.String()
 }
 
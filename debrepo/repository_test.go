@@ -45,6 +45,32 @@ var sourceTests = []struct {
 		str:    "",
 		err:    ErrInvalidRepository,
 	},
+	{
+		entry: "deb http://example.com/debian ./",
+		source: &Repository{
+			repoType:     "deb",
+			baseURI:      "http://example.com/debian",
+			distribution: "./",
+		},
+		str: "deb http://example.com/debian ./",
+		err: nil,
+	},
+	{
+		entry: "deb http://example.com/debian subdir/",
+		source: &Repository{
+			repoType:     "deb",
+			baseURI:      "http://example.com/debian",
+			distribution: "subdir/",
+		},
+		str: "deb http://example.com/debian subdir/",
+		err: nil,
+	},
+	{
+		entry:  "deb http://example.com/debian subdir/ main", // components in flat repository
+		source: nil,
+		str:    "",
+		err:    ErrInvalidRepository,
+	},
 	{
 		entry:  "deb #notURL saucy universe",
 		source: nil,
@@ -95,3 +121,58 @@ func TestRepository_ReleaseURL(t *testing.T) {
 		t.Fatalf("expected=%s actual=%s", expected, actual)
 	}
 }
+
+var repositoryURLTests = []struct {
+	entry      string
+	inRelease  string
+	release    string
+	releaseGPG string
+	dist       string
+	file       string
+}{
+	{
+		entry:      "deb http://ftp.debian.org/debian squeeze main",
+		inRelease:  "http://ftp.debian.org/debian/dists/squeeze/InRelease",
+		release:    "http://ftp.debian.org/debian/dists/squeeze/Release",
+		releaseGPG: "http://ftp.debian.org/debian/dists/squeeze/Release.gpg",
+		dist:       "http://ftp.debian.org/debian/dists/squeeze/main/binary-amd64/Packages",
+		file:       "http://ftp.debian.org/debian/pool/main/f/foo/foo.deb",
+	},
+	{
+		entry:      "deb http://example.com/debian ./",
+		inRelease:  "http://example.com/debian/InRelease",
+		release:    "http://example.com/debian/Release",
+		releaseGPG: "http://example.com/debian/Release.gpg",
+		dist:       "http://example.com/debian/main/binary-amd64/Packages",
+		file:       "http://example.com/debian/pool/main/f/foo/foo.deb",
+	},
+	{
+		entry:      "deb http://example.com/debian/ subdir/",
+		inRelease:  "http://example.com/debian/subdir/InRelease",
+		release:    "http://example.com/debian/subdir/Release",
+		releaseGPG: "http://example.com/debian/subdir/Release.gpg",
+		dist:       "http://example.com/debian/subdir/main/binary-amd64/Packages",
+		file:       "http://example.com/debian/pool/main/f/foo/foo.deb",
+	},
+}
+
+func TestRepository_URLs(t *testing.T) {
+	for i, tt := range repositoryURLTests {
+		r, err := ParseRepository(tt.entry)
+		if err != nil {
+			t.Fatalf("test(%v): unexpected error: %v", i, err)
+		}
+		urls := []struct{ expected, actual string }{
+			{tt.inRelease, r.InReleaseURL()},
+			{tt.release, r.ReleaseURL()},
+			{tt.releaseGPG, r.ReleaseGPGURL()},
+			{tt.dist, r.distURL("main/binary-amd64/Packages")},
+			{tt.file, r.fileURL("pool/main/f/foo/foo.deb")},
+		}
+		for _, u := range urls {
+			if u.expected != u.actual {
+				t.Fatalf("test(%v): expected=%s actual=%s", i, u.expected, u.actual)
+			}
+		}
+	}
+}
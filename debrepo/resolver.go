@@ -0,0 +1,293 @@
+package debrepo
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// resolverMaxSteps bounds the number of candidate selections tried by
+// Resolver.Resolve before giving up.
+const resolverMaxSteps = 100000
+
+// ResolvedPackage is a package selected by a Resolver along with the
+// repository it was found in. It can be passed to Client.DownloadPackage.
+type ResolvedPackage struct {
+	Package    *Package
+	Repository *Repository
+	version    Version
+}
+
+func (rp *ResolvedPackage) String() string {
+	return rp.Package.Package + " " + rp.Package.Version
+}
+
+// ResolveError is returned by Resolver.Resolve when no consistent set of
+// packages satisfies the request. Reasons lists the unsatisfiable
+// dependencies and conflicts encountered while searching for a solution.
+type ResolveError struct {
+	Reasons []string
+}
+
+func (e *ResolveError) Error() string {
+	return "unable to resolve dependencies: " + strings.Join(e.Reasons, "; ")
+}
+
+// A Resolver computes the set of packages needed to install a list of
+// requested packages. Packages are added from the indexes of one or more
+// repositories with Add.
+//
+// Depends and Pre-Depends are followed; Recommends and Suggests are not.
+// Alternatives are tried in order, and for each alternative the highest
+// version is preferred. Packages providing the name are tried after real
+// packages in the order they were added. Packages which Conflict with or
+// Break each other are never selected together.
+type Resolver struct {
+	// Architecture restricts candidates to packages of this architecture or
+	// of architecture "all".
+	Architecture string
+
+	packages map[string][]*ResolvedPackage
+	provides map[string][]*ResolvedPackage
+}
+
+// NewResolver returns a Resolver for packages of architecture arch.
+func NewResolver(arch string) *Resolver {
+	return &Resolver{
+		Architecture: arch,
+		packages:     make(map[string][]*ResolvedPackage),
+		provides:     make(map[string][]*ResolvedPackage),
+	}
+}
+
+// Add adds the packages read from the package indexes of repo. Packages
+// added earlier are preferred when two repositories contain the same
+// version.
+func (r *Resolver) Add(repo *Repository, pkgs []*Package) error {
+	for _, pkg := range pkgs {
+		if pkg.Architecture != r.Architecture && pkg.Architecture != "all" {
+			continue
+		}
+		v, err := ParseVersion(pkg.Version)
+		if err != nil {
+			return errors.Wrapf(err, "package %s", pkg.Package)
+		}
+		rp := &ResolvedPackage{Package: pkg, Repository: repo, version: v}
+		r.packages[pkg.Package] = append(r.packages[pkg.Package], rp)
+		for _, alts := range pkg.Provides {
+			for _, p := range alts {
+				r.provides[p.Name] = append(r.provides[p.Name], rp)
+			}
+		}
+	}
+	for _, rps := range r.packages {
+		sort.Stable(byVersionDesc(rps))
+	}
+	return nil
+}
+
+// Resolve returns a consistent set of packages satisfying requests and all of
+// their dependencies. Each request is a package name, optionally followed by a
+// version constraint such as "libc6 (>= 2.23)". If no solution exists a
+// *ResolveError is returned.
+func (r *Resolver) Resolve(requests ...string) ([]*ResolvedPackage, error) {
+	s := &resolveState{selected: make(map[string]*ResolvedPackage)}
+	for _, req := range requests {
+		rel, err := ParseRelation(req)
+		if err != nil {
+			return nil, err
+		}
+		s.pending = append(s.pending, pendingDependency{alts: Alternatives{rel}})
+	}
+	rs := &resolveSearch{Resolver: r, seen: make(map[string]bool)}
+	solution := rs.solve(s)
+	if rs.steps > resolverMaxSteps {
+		return nil, errors.New("dependency resolution exceeded search limit")
+	}
+	if solution == nil {
+		return nil, &ResolveError{Reasons: rs.reasons}
+	}
+	result := make([]*ResolvedPackage, 0, len(solution.selected))
+	for _, rp := range solution.selected {
+		result = append(result, rp)
+	}
+	sort.Sort(byName(result))
+	return result, nil
+}
+
+type pendingDependency struct {
+	from *ResolvedPackage
+	alts Alternatives
+}
+
+func (d pendingDependency) String() string {
+	if d.from == nil {
+		return "requested " + d.alts.String()
+	}
+	return fmt.Sprintf("%s depends on %s", d.from, d.alts)
+}
+
+type resolveState struct {
+	selected map[string]*ResolvedPackage
+	pending  []pendingDependency
+}
+
+func (s *resolveState) clone() *resolveState {
+	c := &resolveState{
+		selected: make(map[string]*ResolvedPackage, len(s.selected)+1),
+		pending:  make([]pendingDependency, len(s.pending)),
+	}
+	for k, v := range s.selected {
+		c.selected[k] = v
+	}
+	copy(c.pending, s.pending)
+	return c
+}
+
+func (s *resolveState) add(rp *ResolvedPackage) {
+	s.selected[rp.Package.Package] = rp
+	for _, deps := range []Dependencies{rp.Package.PreDepends, rp.Package.Depends} {
+		for _, alts := range deps {
+			s.pending = append(s.pending, pendingDependency{from: rp, alts: alts})
+		}
+	}
+}
+
+// resolveSearch holds the state of a single call to Resolver.Resolve.
+type resolveSearch struct {
+	*Resolver
+	steps   int
+	reasons []string
+	seen    map[string]bool
+}
+
+func (rs *resolveSearch) fail(reason string) {
+	if !rs.seen[reason] {
+		rs.seen[reason] = true
+		rs.reasons = append(rs.reasons, reason)
+	}
+}
+
+// solve processes the pending dependencies of s, backtracking over the
+// candidates for each. It returns nil if no solution exists.
+func (rs *resolveSearch) solve(s *resolveState) *resolveState {
+	for len(s.pending) > 0 {
+		dep := s.pending[0]
+		s.pending = s.pending[1:]
+		if rs.satisfied(s, dep.alts) {
+			continue
+		}
+		candidates := rs.candidates(s, dep)
+		if len(candidates) == 0 {
+			rs.fail(dep.String() + " but no installable package satisfies it")
+			return nil
+		}
+		for _, c := range candidates {
+			if rs.steps++; rs.steps > resolverMaxSteps {
+				return nil
+			}
+			if reason := conflicts(s, c); len(reason) != 0 {
+				rs.fail(reason)
+				continue
+			}
+			next := s.clone()
+			next.add(c)
+			if solution := rs.solve(next); solution != nil {
+				return solution
+			}
+		}
+		return nil
+	}
+	return s
+}
+
+// satisfied reports whether a selected package satisfies alts.
+func (rs *resolveSearch) satisfied(s *resolveState, alts Alternatives) bool {
+	for _, rel := range alts {
+		if rp, ok := s.selected[rel.Name]; ok && rel.Satisfies(rp.Package) {
+			return true
+		}
+		for _, rp := range rs.provides[rel.Name] {
+			if s.selected[rp.Package.Package] == rp && rel.Satisfies(rp.Package) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// candidates returns the packages which satisfy dep in order of preference.
+// Packages whose name is already selected at another version are excluded.
+func (rs *resolveSearch) candidates(s *resolveState, dep pendingDependency) []*ResolvedPackage {
+	var candidates []*ResolvedPackage
+	added := make(map[*ResolvedPackage]bool)
+	for _, rel := range dep.alts {
+		for _, rps := range [][]*ResolvedPackage{rs.packages[rel.Name], rs.provides[rel.Name]} {
+			for _, rp := range rps {
+				if added[rp] || !rel.Satisfies(rp.Package) {
+					continue
+				}
+				if selected, ok := s.selected[rp.Package.Package]; ok && selected != rp {
+					rs.fail(fmt.Sprintf("%s but %s is already selected", dep, selected))
+					continue
+				}
+				added[rp] = true
+				candidates = append(candidates, rp)
+			}
+		}
+	}
+	return candidates
+}
+
+// conflicts returns a description of the conflict between rp and the selected
+// packages in s, or an empty string if there is none.
+func conflicts(s *resolveState, rp *ResolvedPackage) string {
+	for _, selected := range s.selected {
+		if selected.Package.Package == rp.Package.Package {
+			continue
+		}
+		if field, rel, ok := conflictsWith(rp, selected); ok {
+			return fmt.Sprintf("%s %s %s (%s)", rp, field, selected, rel)
+		}
+		if field, rel, ok := conflictsWith(selected, rp); ok {
+			return fmt.Sprintf("%s %s %s (%s)", selected, field, rp, rel)
+		}
+	}
+	return ""
+}
+
+// conflictsWith reports whether a declares a Conflicts or Breaks relation
+// satisfied by b.
+func conflictsWith(a, b *ResolvedPackage) (field string, rel Relation, ok bool) {
+	fields := []struct {
+		name string
+		deps Dependencies
+	}{
+		{"conflicts with", a.Package.Conflicts},
+		{"breaks", a.Package.Breaks},
+	}
+	for _, f := range fields {
+		for _, alts := range f.deps {
+			for _, rel := range alts {
+				if rel.Satisfies(b.Package) {
+					return f.name, rel, true
+				}
+			}
+		}
+	}
+	return "", Relation{}, false
+}
+
+type byVersionDesc []*ResolvedPackage
+
+func (s byVersionDesc) Len() int           { return len(s) }
+func (s byVersionDesc) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s byVersionDesc) Less(i, j int) bool { return s[i].version.Compare(s[j].version) > 0 }
+
+type byName []*ResolvedPackage
+
+func (s byName) Len() int           { return len(s) }
+func (s byName) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s byName) Less(i, j int) bool { return s[i].Package.Package < s[j].Package.Package }
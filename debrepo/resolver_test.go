@@ -0,0 +1,183 @@
+package debrepo
+
+import (
+	"bytes"
+	"compress/gzip"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testResolverPackages = `Package: app
+Version: 1.0
+Architecture: amd64
+Depends: libfoo (>= 2), mail-transport-agent, editor | vim
+
+Package: libfoo
+Version: 1.0
+Architecture: amd64
+
+Package: libfoo
+Version: 2.0
+Architecture: amd64
+Pre-Depends: libc
+
+Package: libfoo
+Version: 3.0
+Architecture: i386
+
+Package: libc
+Version: 2.23
+Architecture: amd64
+
+Package: postfix
+Version: 3.0
+Architecture: amd64
+Provides: mail-transport-agent
+Conflicts: mail-transport-agent
+
+Package: exim
+Version: 4.0
+Architecture: amd64
+Provides: mail-transport-agent
+Conflicts: mail-transport-agent
+
+Package: vim
+Version: 7.4
+Architecture: amd64
+
+Package: nano
+Version: 2.5
+Architecture: all
+Provides: editor
+Breaks: vim (<< 8)
+`
+
+var resolverTests = []struct {
+	requests []string
+	extra    string
+	expected []string
+	valid    bool
+}{
+	{
+		requests: []string{"app"},
+		expected: []string{"app 1.0", "libc 2.23", "libfoo 2.0", "nano 2.5", "postfix 3.0"},
+		valid:    true,
+	},
+	{ // requested vim is broken by nano, so the vim alternative is used
+		requests: []string{"vim", "app"},
+		expected: []string{"app 1.0", "libc 2.23", "libfoo 2.0", "postfix 3.0", "vim 7.4"},
+		valid:    true,
+	},
+	{ // requested exim conflicts with postfix
+		requests: []string{"exim", "app"},
+		expected: []string{"app 1.0", "exim 4.0", "libc 2.23", "libfoo 2.0", "nano 2.5"},
+		valid:    true,
+	},
+	{
+		requests: []string{"libfoo (<< 2)"},
+		expected: []string{"libfoo 1.0"},
+		valid:    true,
+	},
+	{ // second repository contains a newer libfoo
+		requests: []string{"libfoo"},
+		extra:    "Package: libfoo\nVersion: 2.1\nArchitecture: amd64\n",
+		expected: []string{"libfoo 2.1"},
+		valid:    true,
+	},
+	{
+		requests: []string{"libfoo (>= 3)"},
+		valid:    false,
+	},
+	{
+		requests: []string{"postfix", "exim"},
+		valid:    false,
+	},
+	{
+		requests: []string{"missing"},
+		valid:    false,
+	},
+}
+
+func TestResolver_Resolve(t *testing.T) {
+	pkgs, err := NewPackageReader(bytes.NewBufferString(testResolverPackages)).ReadAll()
+	if err != nil {
+		t.Fatalf("unexpected error reading packages: %v", err)
+	}
+	repo, _ := ParseRepository("deb http://archive.ubuntu.com/ubuntu xenial main")
+	for i, test := range resolverTests {
+		r := NewResolver("amd64")
+		if err := r.Add(repo, pkgs); err != nil {
+			t.Fatalf("test(%v): unexpected error adding packages: %v", i, err)
+		}
+		if len(test.extra) != 0 {
+			extra, _ := NewPackageReader(bytes.NewBufferString(test.extra)).ReadAll()
+			r.Add(repo, extra)
+		}
+		resolved, err := r.Resolve(test.requests...)
+		if expected, actual := test.valid, err == nil; expected != actual {
+			t.Fatalf("test(%v): valid: expected=%v actual=%v: %v", i, expected, actual, err)
+		}
+		if !test.valid {
+			if _, ok := err.(*ResolveError); !ok {
+				t.Fatalf("test(%v): expected *ResolveError, got: %v", i, err)
+			}
+			continue
+		}
+		var actual []string
+		for _, rp := range resolved {
+			actual = append(actual, rp.String())
+			if rp.Repository != repo {
+				t.Fatalf("test(%v): expected repository to be set on %s", i, rp)
+			}
+		}
+		if !reflect.DeepEqual(test.expected, actual) {
+			t.Fatalf("test(%v): expected=%v actual=%v", i, test.expected, actual)
+		}
+	}
+}
+
+func TestResolver_Resolve_Unsatisfiable_ExplainsReason(t *testing.T) {
+	pkgs, _ := NewPackageReader(bytes.NewBufferString(testResolverPackages)).ReadAll()
+	r := NewResolver("amd64")
+	r.Add(&Repository{}, pkgs)
+	_, err := r.Resolve("postfix", "exim")
+	resolveErr, ok := err.(*ResolveError)
+	if !ok {
+		t.Fatalf("expected *ResolveError, got: %v", err)
+	}
+	if expected, actual := []string{"exim 4.0 conflicts with postfix 3.0 (mail-transport-agent)"}, resolveErr.Reasons; !reflect.DeepEqual(expected, actual) {
+		t.Fatalf("expected=%v actual=%v", expected, actual)
+	}
+}
+
+func TestResolver_Resolve_TestRepository(t *testing.T) {
+	f, err := os.Open("testdata/test_repo/ubuntu/dists/xenial/main/binary-amd64/Packages.gz")
+	if err != nil {
+		t.Fatalf("unexpected error opening Packages file: %v", err)
+	}
+	defer f.Close()
+	gz, _ := gzip.NewReader(f)
+	pkgs, err := NewPackageReader(gz).ReadAll()
+	if err != nil {
+		t.Fatalf("unexpected error reading packages: %v", err)
+	}
+	r := NewResolver("amd64")
+	if err := r.Add(&Repository{}, pkgs); err != nil {
+		t.Fatalf("unexpected error adding packages: %v", err)
+	}
+	resolved, err := r.Resolve("a11y-profile-manager")
+	if err != nil {
+		t.Fatalf("unexpected error resolving: %v", err)
+	}
+	var names []string
+	for _, rp := range resolved {
+		names = append(names, rp.Package.Package)
+	}
+	for _, name := range []string{"a11y-profile-manager", "libc6", "libglib2.0-0"} {
+		if !strings.Contains(" "+strings.Join(names, " ")+" ", " "+name+" ") {
+			t.Fatalf("expected %s in resolved packages: %v", name, names)
+		}
+	}
+}
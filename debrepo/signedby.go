@@ -0,0 +1,130 @@
+package debrepo
+
+import (
+	"bytes"
+	"encoding/hex"
+	"strings"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/openpgp"
+)
+
+// SignedByKeyRing returns the keyring trusted to sign the repository's Release
+// file, following apt's signed-by behaviour. If the repository was given an
+// inline key block (see SignedByKey), only the keys in that block are trusted.
+// Otherwise each value of the "signed-by" option is either the path to a
+// keyring file, whose keys are trusted, or the fingerprint of a key in
+// keyring, which is then trusted. A fingerprint matches a primary key and its
+// subkeys; a fingerprint followed by "!" matches only that exact key.
+//
+// If the repository has no signed-by restriction keyring is returned
+// unchanged.
+func (r Repository) SignedByKeyRing(keyring openpgp.KeyRing) (openpgp.KeyRing, error) {
+	if len(r.signedByKey) != 0 {
+		k, err := KeyRingFromArmored(strings.NewReader(r.signedByKey))
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid inline Signed-By key")
+		}
+		return k.Entities, nil
+	}
+	values := r.Option("signed-by")
+	if len(values) == 0 {
+		return keyring, nil
+	}
+	kr := &signedByKeyRing{keyring: keyring}
+	for _, value := range values {
+		if strings.ContainsRune(value, '/') {
+			k, err := KeyRingFromFile(value)
+			if err != nil {
+				return nil, err
+			}
+			kr.entities = append(kr.entities, k.Entities...)
+			continue
+		}
+		fp, err := parseSignedByFingerprint(value)
+		if err != nil {
+			return nil, err
+		}
+		kr.fingerprints = append(kr.fingerprints, fp)
+	}
+	return kr, nil
+}
+
+// CheckRepositorySignature is like CheckSignature but only accepts signatures
+// made by the keys repo is restricted to. See Repository.SignedByKeyRing.
+func (r *Release) CheckRepositorySignature(repo *Repository, keyring openpgp.KeyRing) (signer *openpgp.Entity, err error) {
+	keyring, err = repo.SignedByKeyRing(keyring)
+	if err != nil {
+		return nil, err
+	}
+	return r.CheckSignature(keyring)
+}
+
+type signedByFingerprint struct {
+	fingerprint []byte
+	exact       bool
+}
+
+func parseSignedByFingerprint(value string) (signedByFingerprint, error) {
+	fp := signedByFingerprint{}
+	if strings.HasSuffix(value, "!") {
+		value, fp.exact = value[:len(value)-1], true
+	}
+	b, err := hex.DecodeString(value)
+	if err != nil || len(b) != 20 {
+		return fp, errors.Errorf("invalid signed-by value: %q", value)
+	}
+	fp.fingerprint = b
+	return fp, nil
+}
+
+func (fp signedByFingerprint) matches(key openpgp.Key) bool {
+	if key.PublicKey != nil && bytes.Equal(key.PublicKey.Fingerprint[:], fp.fingerprint) {
+		return true
+	}
+	return !fp.exact && key.Entity != nil && key.Entity.PrimaryKey != nil &&
+		bytes.Equal(key.Entity.PrimaryKey.Fingerprint[:], fp.fingerprint)
+}
+
+// signedByKeyRing is an openpgp.KeyRing containing the keys from signed-by
+// keyring files and the keys of a wider keyring matching signed-by
+// fingerprints.
+type signedByKeyRing struct {
+	entities     openpgp.EntityList
+	keyring      openpgp.KeyRing
+	fingerprints []signedByFingerprint
+}
+
+func (kr *signedByKeyRing) KeysById(id uint64) []openpgp.Key {
+	keys := kr.entities.KeysById(id)
+	if kr.keyring == nil || len(kr.fingerprints) == 0 {
+		return keys
+	}
+	return kr.filter(keys, kr.keyring.KeysById(id))
+}
+
+func (kr *signedByKeyRing) KeysByIdUsage(id uint64, requiredUsage byte) []openpgp.Key {
+	keys := kr.entities.KeysByIdUsage(id, requiredUsage)
+	if kr.keyring == nil || len(kr.fingerprints) == 0 {
+		return keys
+	}
+	return kr.filter(keys, kr.keyring.KeysByIdUsage(id, requiredUsage))
+}
+
+func (kr *signedByKeyRing) DecryptionKeys() []openpgp.Key {
+	return nil
+}
+
+// filter appends the keys in candidates matching a signed-by fingerprint to
+// keys.
+func (kr *signedByKeyRing) filter(keys, candidates []openpgp.Key) []openpgp.Key {
+	for _, key := range candidates {
+		for _, fp := range kr.fingerprints {
+			if fp.matches(key) {
+				keys = append(keys, key)
+				break
+			}
+		}
+	}
+	return keys
+}
@@ -0,0 +1,132 @@
+package debrepo
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/armor"
+	"golang.org/x/net/context"
+)
+
+func TestClientGetReleaseIndex_SignedBy_OnlyAcceptsPinnedKeys(t *testing.T) {
+	inRelease, _, _, keyRing := newTestKeyRingAndRelease()
+	signer := keyRing.(*testKeyRing).el[0]
+	other := testGenerateEntityList()[0]
+	global := &testKeyRing{openpgp.EntityList{signer, other}}
+
+	dir, err := ioutil.TempDir("", "debrepo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	signerFile := filepath.Join(dir, "signer.asc")
+	otherFile := filepath.Join(dir, "other.gpg")
+	if err := ioutil.WriteFile(signerFile, []byte(testArmoredPublicKey(signer)), 0644); err != nil {
+		t.Fatal(err)
+	}
+	otherKey := &bytes.Buffer{}
+	if err := other.Serialize(otherKey); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(otherFile, otherKey.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	deb822 := func(key *openpgp.Entity) string {
+		lines := strings.Split(strings.TrimSpace(testArmoredPublicKey(key)), "\n")
+		for i, line := range lines {
+			if len(line) == 0 {
+				line = "."
+			}
+			lines[i] = " " + line
+		}
+		return "Types: deb\nURIs: http://example.com/ubuntu\nSuites: xenial\nComponents: main\nSigned-By:\n" +
+			strings.Join(lines, "\n") + "\n"
+	}
+	tests := []struct {
+		entry    string
+		deb822   bool
+		expected bool
+	}{
+		{"deb http://example.com/ubuntu xenial main", false, true},
+		{fmt.Sprintf("deb [signed-by=%X] http://example.com/ubuntu xenial main", signer.PrimaryKey.Fingerprint), false, true},
+		{fmt.Sprintf("deb [signed-by=%X!] http://example.com/ubuntu xenial main", signer.PrimaryKey.Fingerprint), false, true},
+		{fmt.Sprintf("deb [signed-by=%X] http://example.com/ubuntu xenial main", other.PrimaryKey.Fingerprint), false, false},
+		{"deb [signed-by=" + signerFile + "] http://example.com/ubuntu xenial main", false, true},
+		{"deb [signed-by=" + otherFile + "] http://example.com/ubuntu xenial main", false, false},
+		{"deb [signed-by=" + filepath.Join(dir, "missing.gpg") + "] http://example.com/ubuntu xenial main", false, false},
+		{"deb [signed-by=nothex] http://example.com/ubuntu xenial main", false, false},
+		{deb822(signer), true, true},
+		{deb822(other), true, false},
+	}
+	for i, test := range tests {
+		var repo *Repository
+		if test.deb822 {
+			list, err := ParseDeb822Sources(strings.NewReader(test.entry))
+			if err != nil {
+				t.Fatalf("test(%v): unexpected error: %v", i, err)
+			}
+			repo = list[0]
+		} else {
+			if repo, err = ParseRepository(test.entry); err != nil {
+				t.Fatalf("test(%v): unexpected error: %v", i, err)
+			}
+		}
+		client := &Client{KeyRing: global, Architecture: "amd64"}
+		client.testhookGetFile = func(ctx context.Context, url string) ([]byte, error) {
+			return inRelease, nil
+		}
+		_, err := client.GetReleaseIndex(context.Background(), repo)
+		if expected, actual := test.expected, err == nil; expected != actual {
+			t.Fatalf("test(%v): expected=%v actual=%v", i, expected, err)
+		}
+	}
+}
+
+func TestReleaseCheckRepositorySignature_UnpinnedSigner_ReturnsError(t *testing.T) {
+	_, release, releaseGPG, keyRing := newTestKeyRingAndRelease()
+	signer := keyRing.(*testKeyRing).el[0]
+	other := testGenerateEntityList()[0]
+	global := openpgp.EntityList{signer, other}
+
+	tests := []struct {
+		fingerprint [20]byte
+		expected    bool
+	}{
+		{signer.PrimaryKey.Fingerprint, true},
+		{other.PrimaryKey.Fingerprint, false},
+	}
+	for i, test := range tests {
+		repo, _ := ParseRepository(fmt.Sprintf("deb [signed-by=%X] http://example.com/ubuntu xenial main", test.fingerprint))
+		signature, err := armor.Decode(bytes.NewReader(releaseGPG))
+		if err != nil {
+			t.Fatal(err)
+		}
+		r := &Release{Plaintext: release, ArmoredSignature: signature}
+		_, err = r.CheckRepositorySignature(repo, global)
+		if expected, actual := test.expected, err == nil; expected != actual {
+			t.Fatalf("test(%v): expected=%v actual=%v", i, expected, err)
+		}
+	}
+}
+
+func testArmoredPublicKey(e *openpgp.Entity) string {
+	buf := &bytes.Buffer{}
+	w, err := armor.Encode(buf, openpgp.PublicKeyType, nil)
+	if err != nil {
+		panic(err)
+	}
+	if err := e.Serialize(w); err != nil {
+		panic(err)
+	}
+	if err := w.Close(); err != nil {
+		panic(err)
+	}
+	return buf.String()
+}
@@ -0,0 +1,233 @@
+package debrepo
+
+import (
+	"crypto"
+	"io"
+	"strings"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/clearsign"
+)
+
+// SourcePackage is a source package entry read from a Sources index file.
+//
+// Files and the Checksums fields list the files making up the source package,
+// which are found in Directory relative to the repository's base URI.
+//
+// Fields contains every field present in the entry, including those which
+// have no corresponding struct field.
+type SourcePackage struct {
+	Package             string       `deb822:"Package"`
+	Binary              []string     `deb822:"Binary,comma,omitempty"`
+	Version             string       `deb822:"Version"`
+	Maintainer          string       `deb822:"Maintainer,omitempty"`
+	Uploaders           string       `deb822:"Uploaders,omitempty"`
+	Architecture        []string     `deb822:"Architecture,omitempty"`
+	Format              string       `deb822:"Format,omitempty"`
+	Priority            string       `deb822:"Priority,omitempty"`
+	Section             string       `deb822:"Section,omitempty"`
+	Directory           string       `deb822:"Directory"`
+	StandardsVersion    string       `deb822:"Standards-Version,omitempty"`
+	Homepage            string       `deb822:"Homepage,omitempty"`
+	VcsBrowser          string       `deb822:"Vcs-Browser,omitempty"`
+	VcsGit              string       `deb822:"Vcs-Git,omitempty"`
+	BuildDepends        Dependencies `deb822:"Build-Depends,omitempty"`
+	BuildDependsIndep   Dependencies `deb822:"Build-Depends-Indep,omitempty"`
+	BuildDependsArch    Dependencies `deb822:"Build-Depends-Arch,omitempty"`
+	BuildConflicts      Dependencies `deb822:"Build-Conflicts,omitempty"`
+	BuildConflictsIndep Dependencies `deb822:"Build-Conflicts-Indep,omitempty"`
+	BuildConflictsArch  Dependencies `deb822:"Build-Conflicts-Arch,omitempty"`
+	Files               []SourceFile `deb822:"Files"`
+	ChecksumsSHA1       []SourceFile `deb822:"Checksums-Sha1,omitempty"`
+	ChecksumsSHA256     []SourceFile `deb822:"Checksums-Sha256,omitempty"`
+	ChecksumsSHA512     []SourceFile `deb822:"Checksums-Sha512,omitempty"`
+	Fields              Fields       `deb822:"-"`
+}
+
+// SourceFile is a row of the Files or Checksums tables of a source package.
+// Files lists MD5 checksums.
+type SourceFile struct {
+	HashSum []byte
+	Size    int64
+	Name    string
+}
+
+// SourceReader reads the entries of a Sources index. See
+// Client.GetSourceIndexes.
+type SourceReader struct {
+	r *ParagraphReader
+}
+
+// NewSourceReader returns a SourceReader which reads from r.
+func NewSourceReader(r io.Reader) *SourceReader {
+	return &SourceReader{r: NewParagraphReader(r)}
+}
+
+// Read returns the next source package. It returns io.EOF when no entries
+// remain.
+func (sr *SourceReader) Read() (*SourcePackage, error) {
+	fields, err := sr.r.Read()
+	if err != nil {
+		return nil, err
+	}
+	return parseSourcePackage(fields)
+}
+
+// ReadAll returns the remaining SourcePackage entries in the index.
+func (sr *SourceReader) ReadAll() ([]*SourcePackage, error) {
+	var srcs []*SourcePackage
+	for {
+		src, err := sr.Read()
+		if err == io.EOF {
+			return srcs, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		srcs = append(srcs, src)
+	}
+}
+
+func parseSourcePackage(fields Fields) (*SourcePackage, error) {
+	src := &SourcePackage{}
+	if err := UnmarshalFields(fields, src); err != nil {
+		if name := fields.Get("Package"); len(name) != 0 {
+			return nil, errors.Wrapf(err, "source package %s", name)
+		}
+		return nil, err
+	}
+	if len(src.Package) == 0 {
+		return nil, errors.New("source entry missing Package field")
+	}
+	for _, table := range [][]SourceFile{src.Files, src.ChecksumsSHA1, src.ChecksumsSHA256, src.ChecksumsSHA512} {
+		for _, f := range table {
+			if f.Size < 0 {
+				return nil, errors.Errorf("source package %s: negative size for file %s", src.Package, f.Name)
+			}
+		}
+	}
+	src.Fields = fields
+	return src, nil
+}
+
+// strongestChecksums returns the strongest checksum table listed for the
+// source package. The Files table holds MD5 checksums. MD5 and SHA1 tables are
+// only returned if allowWeak is true.
+func (src *SourcePackage) strongestChecksums(allowWeak bool) (crypto.Hash, []SourceFile, error) {
+	tables := []struct {
+		hash  crypto.Hash
+		files []SourceFile
+	}{
+		{crypto.SHA512, src.ChecksumsSHA512},
+		{crypto.SHA256, src.ChecksumsSHA256},
+		{crypto.SHA1, src.ChecksumsSHA1},
+		{crypto.MD5, src.Files},
+	}
+	for _, t := range tables {
+		if len(t.files) != 0 && (allowWeak || !isWeakHash(t.hash)) {
+			return t.hash, t.files, nil
+		}
+	}
+	return 0, nil, errors.Errorf("source package %s has no SHA256 or SHA512 checksums", src.Package)
+}
+
+// fileMeta returns the size and every checksum listed for the file name in
+// the source package's checksum tables. It returns false if the file is not
+// listed, and an error if it is listed with different sizes.
+func (src *SourcePackage) fileMeta(name string) (FileMeta, bool, error) {
+	tables := []struct {
+		hash  crypto.Hash
+		files []SourceFile
+	}{
+		{crypto.MD5, src.Files},
+		{crypto.SHA1, src.ChecksumsSHA1},
+		{crypto.SHA256, src.ChecksumsSHA256},
+		{crypto.SHA512, src.ChecksumsSHA512},
+	}
+	meta := FileMeta{Size: -1, Hashes: make(map[crypto.Hash][]byte)}
+	for _, t := range tables {
+		f, ok := findSourceFile(t.files, name)
+		if !ok {
+			continue
+		}
+		if meta.Size >= 0 && meta.Size != f.Size {
+			return FileMeta{}, false, errors.Errorf("file %s listed with different sizes", name)
+		}
+		meta.Size = f.Size
+		meta.Hashes[t.hash] = f.HashSum
+		meta.Hash, meta.HashSum = t.hash, f.HashSum
+	}
+	return meta, meta.Size >= 0, nil
+}
+
+// dscFile returns the .dsc file listed in table.
+func (src *SourcePackage) dscFile(table []SourceFile) (SourceFile, error) {
+	var dsc []SourceFile
+	for _, f := range table {
+		if strings.HasSuffix(f.Name, ".dsc") {
+			dsc = append(dsc, f)
+		}
+	}
+	if len(dsc) != 1 {
+		return SourceFile{}, errors.Errorf("source package %s lists %d .dsc files", src.Package, len(dsc))
+	}
+	if !isValidSourceFileName(dsc[0].Name) {
+		return SourceFile{}, errors.Errorf("source package %s: invalid file name %q", src.Package, dsc[0].Name)
+	}
+	return dsc[0], nil
+}
+
+// findSourceFile returns the file in table with the given name.
+func findSourceFile(table []SourceFile, name string) (SourceFile, bool) {
+	for _, f := range table {
+		if f.Name == name {
+			return f, true
+		}
+	}
+	return SourceFile{}, false
+}
+
+// isValidSourceFileName returns true if name can be used as the name of a
+// file in the download directory. Source files are always found directly in
+// the source package's Directory.
+func isValidSourceFileName(name string) bool {
+	return len(name) != 0 && name != "." && name != ".." && !strings.ContainsAny(name, "/\\\x00")
+}
+
+// readDsc parses the .dsc file b. The Package field of the returned
+// SourcePackage is set from the Source field of the .dsc file. An error is
+// returned if the .dsc file lists no files or a file name is not a plain file
+// name. If keyring is not nil, b must be clearsigned by a key in keyring.
+// Signatures using hash functions rejected by policy fail.
+func readDsc(b []byte, keyring openpgp.KeyRing, policy SignaturePolicy) (*SourcePackage, error) {
+	if block, _ := clearsign.Decode(b); block != nil {
+		if keyring != nil {
+			if _, err := verifySignatures(keyring, block.Bytes, block.ArmoredSignature.Body, policy); err != nil {
+				return nil, errors.Wrap(err, "signature check failed")
+			}
+		}
+		b = block.Plaintext
+	} else if keyring != nil {
+		return nil, errors.New("file is not clearsigned")
+	}
+	fields, err := ReadFields(b)
+	if err != nil {
+		return nil, err
+	}
+	dsc := &SourcePackage{}
+	if err := UnmarshalFields(fields, dsc); err != nil {
+		return nil, err
+	}
+	dsc.Package = fields.Get("Source")
+	dsc.Fields = fields
+	if len(dsc.Files) == 0 {
+		return nil, errors.New("missing Files field")
+	}
+	for _, f := range dsc.Files {
+		if !isValidSourceFileName(f.Name) {
+			return nil, errors.Errorf("invalid file name %q", f.Name)
+		}
+	}
+	return dsc, nil
+}
@@ -0,0 +1,104 @@
+package debrepo
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+	"testing"
+)
+
+const testSources = `Package: hello
+Binary: hello
+Version: 2.10-1
+Maintainer: Santiago Vila <sanvila@debian.org>
+Build-Depends: debhelper (>= 9.20120311)
+Architecture: any
+Standards-Version: 3.9.6
+Format: 3.0 (quilt)
+Files:
+ bdb7d0f4fd8f1e5bc1b07eb9b4a8e0f5 1349 hello_2.10-1.dsc
+ 6cd0ffea3884a4e79330338dcc2987d6 725946 hello_2.10.orig.tar.gz
+ 0ee75ed6ba9ce2b8e2d9fa4bcc6b7b26 6132 hello_2.10-1.debian.tar.xz
+Checksums-Sha256:
+ b5e16c2ac21f4a3e88b5fb1f8a4a8bdf4ab8e4d5d5e7d8a7a1e6bbdc8ff12d04 1349 hello_2.10-1.dsc
+ 31e066137a962676e89f69d1b65382de95a7ef7d914b8cb956f41ea72e0f516b 725946 hello_2.10.orig.tar.gz
+ a3e5e4d1c7ab8d23f67bc4a0c0e9e7a3b8e3a7a0b5c6e9fa8ec2ea1a6c1ad8e7 6132 hello_2.10-1.debian.tar.xz
+Homepage: http://www.gnu.org/software/hello/
+Package-List:
+ hello deb devel optional arch=any
+Directory: pool/main/h/hello
+Priority: source
+Section: devel
+
+Package: lintian-brush
+Binary: lintian-brush, python3-lintian-brush
+Version: 0.1
+Architecture: all
+Build-Depends: debhelper-compat (= 12), python3-all <!nocheck>
+Build-Depends-Indep: dh-python
+Files:
+ d41d8cd98f00b204e9800998ecf8427e 0 lintian-brush_0.1.dsc
+Directory: pool/main/l/lintian-brush
+`
+
+func TestSourceReader_ReadAll(t *testing.T) {
+	srcs, err := NewSourceReader(bytes.NewBufferString(testSources)).ReadAll()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if expected, actual := 2, len(srcs); expected != actual {
+		t.Fatalf("number of entries: expected=%v actual=%v", expected, actual)
+	}
+	src := srcs[0]
+	if expected, actual := "pool/main/h/hello", src.Directory; expected != actual {
+		t.Fatalf("directory: expected=%v actual=%v", expected, actual)
+	}
+	if expected, actual := []string{"any"}, src.Architecture; !reflect.DeepEqual(expected, actual) {
+		t.Fatalf("architecture: expected=%v actual=%v", expected, actual)
+	}
+	if expected, actual := "debhelper (>= 9.20120311)", src.BuildDepends.String(); expected != actual {
+		t.Fatalf("build depends: expected=%v actual=%v", expected, actual)
+	}
+	expectedFile := SourceFile{
+		HashSum: decodeHexString("6cd0ffea3884a4e79330338dcc2987d6"),
+		Size:    725946,
+		Name:    "hello_2.10.orig.tar.gz",
+	}
+	if expected, actual := 3, len(src.Files); expected != actual {
+		t.Fatalf("files: expected=%v actual=%v", expected, actual)
+	}
+	if expected, actual := expectedFile, src.Files[1]; !reflect.DeepEqual(expected, actual) {
+		t.Fatalf("files: expected=%+v actual=%+v", expected, actual)
+	}
+	if expected, actual := 3, len(src.ChecksumsSHA256); expected != actual {
+		t.Fatalf("sha256 checksums: expected=%v actual=%v", expected, actual)
+	}
+	if expected, actual := "hello deb devel optional arch=any", src.Fields.Folded("Package-List"); expected != actual {
+		t.Fatalf("fields: expected=%v actual=%v", expected, actual)
+	}
+
+	src = srcs[1]
+	if expected, actual := []string{"lintian-brush", "python3-lintian-brush"}, src.Binary; !reflect.DeepEqual(expected, actual) {
+		t.Fatalf("binary: expected=%v actual=%v", expected, actual)
+	}
+	if expected, actual := "python3-all", src.BuildDepends[1][0].Name; expected != actual {
+		t.Fatalf("build depends: expected=%v actual=%v", expected, actual)
+	}
+	if expected, actual := 1, len(src.BuildDependsIndep); expected != actual {
+		t.Fatalf("build depends indep: expected=%v actual=%v", expected, actual)
+	}
+}
+
+func TestSourceReader_InvalidEntry_ReturnsError(t *testing.T) {
+	tests := []string{
+		"Version: 1.0\nDirectory: pool/main/a/a\n",
+		"Package: a\nBuild-Depends: foo (>= \n",
+		"Package: a\nFiles:\n d41d8cd98f00b204e9800998ecf8427e a.dsc\n",
+		"Package: a\nFiles:\n d41d8cd98f00b204e9800998ecf8427e -1 a.dsc\n",
+	}
+	for i, test := range tests {
+		if _, err := NewSourceReader(bytes.NewBufferString(test)).Read(); err == nil || err == io.EOF {
+			t.Fatalf("test(%v): expected error, got: %v", i, err)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package debrepo
+
+import (
+	"bufio"
+	"io"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ParseSourcesList parses the one-line style entries of a sources.list file
+// read from r. Fields may be separated by any amount of whitespace, comments
+// start with '#' and blank lines are ignored. Each entry may carry an options
+// block following its type:
+//
+//	deb [arch=amd64 signed-by=/usr/share/keyrings/x.gpg] http://host/debian stable main
+//
+// If an entry cannot be parsed a *SourcesListError containing the line number
+// is returned.
+func ParseSourcesList(r io.Reader) (RepositoryList, error) {
+	var list RepositoryList
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		repo, err := parseSourcesEntry(scanner.Text())
+		if err != nil {
+			return nil, &SourcesListError{Line: line, Err: err}
+		}
+		if repo != nil {
+			list = append(list, repo)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// parseSourcesEntry parses a single line of a sources.list file. It returns a
+// nil Repository if the line is blank or contains only a comment.
+func parseSourcesEntry(entry string) (*Repository, error) {
+	if i := strings.IndexByte(entry, '#'); i >= 0 {
+		entry = entry[:i]
+	}
+	entry = strings.TrimSpace(entry)
+	if len(entry) == 0 {
+		return nil, nil
+	}
+
+	r := &Repository{}
+	fields := strings.Fields(entry)
+	r.repoType = fields[0]
+	if r.repoType != "deb" && r.repoType != "deb-src" {
+		return nil, errors.Wrapf(ErrInvalidRepository, "unknown type %q", r.repoType)
+	}
+	rest := strings.TrimSpace(entry[len(r.repoType):])
+	if strings.HasPrefix(rest, "[") {
+		end := strings.IndexByte(rest, ']')
+		if end < 0 {
+			return nil, errors.Wrap(ErrInvalidRepository, "unterminated options block")
+		}
+		options, err := parseRepositoryOptions(rest[1:end])
+		if err != nil {
+			return nil, err
+		}
+		r.options = options
+		rest = rest[end+1:]
+	}
+
+	fields = strings.Fields(rest)
+	if len(fields) < 2 {
+		return nil, errors.Wrap(ErrInvalidRepository, "missing URI or distribution")
+	}
+	if !isURL(fields[0]) {
+		return nil, errors.Wrapf(ErrInvalidRepository, "invalid URI %q", fields[0])
+	}
+	r.baseURI = fields[0]
+	r.distribution = fields[1]
+	if len(fields) > 2 {
+		r.components = fields[2:]
+	}
+	if err := r.validateComponents(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// parseRepositoryOptions parses the contents of an options block.
+func parseRepositoryOptions(block string) ([]RepositoryOption, error) {
+	var options []RepositoryOption
+	for _, field := range strings.Fields(block) {
+		i := strings.IndexByte(field, '=')
+		if i <= 0 {
+			return nil, errors.Wrapf(ErrInvalidRepository, "invalid option %q", field)
+		}
+		o := RepositoryOption{Key: field[:i], Op: "="}
+		if c := field[i-1]; c == '+' || c == '-' {
+			o.Key, o.Op = field[:i-1], string(c)+"="
+		}
+		if len(o.Key) == 0 {
+			return nil, errors.Wrapf(ErrInvalidRepository, "invalid option %q", field)
+		}
+		if value := field[i+1:]; len(value) != 0 {
+			o.Values = strings.Split(value, ",")
+		}
+		options = append(options, o)
+	}
+	if len(options) == 0 {
+		return nil, errors.Wrap(ErrInvalidRepository, "empty options block")
+	}
+	return options, nil
+}
@@ -0,0 +1,117 @@
+package debrepo
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+const testSourcesList = `# See http://help.ubuntu.com/community/UpgradeNotes
+deb http://archive.ubuntu.com/ubuntu/	xenial   main restricted
+
+   # deb-src http://archive.ubuntu.com/ubuntu/ xenial main restricted
+deb-src http://archive.ubuntu.com/ubuntu/ xenial main # trailing comment
+deb [arch=amd64,i386 signed-by=/usr/share/keyrings/x.gpg trusted=yes] http://ppa.example.com/ubuntu xenial main
+deb [ arch+=arm64 lang-=de ] http://ppa.example.com/ubuntu xenial universe
+`
+
+func TestParseSourcesList(t *testing.T) {
+	list, err := ParseSourcesList(bytes.NewBufferString(testSourcesList))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := RepositoryList{
+		{
+			repoType:     "deb",
+			baseURI:      "http://archive.ubuntu.com/ubuntu/",
+			distribution: "xenial",
+			components:   []string{"main", "restricted"},
+		},
+		{
+			repoType:     "deb-src",
+			baseURI:      "http://archive.ubuntu.com/ubuntu/",
+			distribution: "xenial",
+			components:   []string{"main"},
+		},
+		{
+			repoType: "deb",
+			options: []RepositoryOption{
+				{Key: "arch", Op: "=", Values: []string{"amd64", "i386"}},
+				{Key: "signed-by", Op: "=", Values: []string{"/usr/share/keyrings/x.gpg"}},
+				{Key: "trusted", Op: "=", Values: []string{"yes"}},
+			},
+			baseURI:      "http://ppa.example.com/ubuntu",
+			distribution: "xenial",
+			components:   []string{"main"},
+		},
+		{
+			repoType: "deb",
+			options: []RepositoryOption{
+				{Key: "arch", Op: "+=", Values: []string{"arm64"}},
+				{Key: "lang", Op: "-=", Values: []string{"de"}},
+			},
+			baseURI:      "http://ppa.example.com/ubuntu",
+			distribution: "xenial",
+			components:   []string{"universe"},
+		},
+	}
+	if !reflect.DeepEqual(expected, list) {
+		t.Fatalf("\nexpected=%v\nactual=%v", expected, list)
+	}
+	if expected, actual := []string{"amd64", "i386"}, list[2].Option("arch"); !reflect.DeepEqual(expected, actual) {
+		t.Fatalf("option arch: expected=%v actual=%v", expected, actual)
+	}
+	if actual := list[3].Option("arch"); actual != nil {
+		t.Fatalf("option arch: expected nil for +=, actual=%v", actual)
+	}
+}
+
+func TestParseSourcesList_String_RoundTrips(t *testing.T) {
+	list, _ := ParseSourcesList(bytes.NewBufferString(testSourcesList))
+	expected := []string{
+		"deb http://archive.ubuntu.com/ubuntu/ xenial main restricted",
+		"deb-src http://archive.ubuntu.com/ubuntu/ xenial main",
+		"deb [arch=amd64,i386 signed-by=/usr/share/keyrings/x.gpg trusted=yes] http://ppa.example.com/ubuntu xenial main",
+		"deb [arch+=arm64 lang-=de] http://ppa.example.com/ubuntu xenial universe",
+	}
+	for i, repo := range list {
+		str := repo.String()
+		if expected, actual := expected[i], str; expected != actual {
+			t.Fatalf("test(%v): expected=%v actual=%v", i, expected, actual)
+		}
+		parsed, err := ParseRepository(str)
+		if err != nil {
+			t.Fatalf("test(%v): unexpected error parsing String(): %v", i, err)
+		}
+		if !reflect.DeepEqual(repo, parsed) {
+			t.Fatalf("test(%v): expected=%v actual=%v", i, repo, parsed)
+		}
+	}
+}
+
+var sourcesListErrorTests = []struct {
+	input string
+	line  int
+}{
+	{"deb http://a/ xenial main\ndeb-foo http://a/ xenial main\n", 2},
+	{"\n\n\ndeb [arch=amd64 http://a/ xenial main\n", 4},
+	{"deb [] http://a/ xenial main\n", 1},
+	{"deb [arch] http://a/ xenial main\n", 1},
+	{"deb [=amd64] http://a/ xenial main\n", 1},
+	{"# comment\ndeb http://a/ xenial\n", 2},
+	{"deb http://a/\n", 1},
+	{"deb notaurl xenial main\n", 1},
+}
+
+func TestParseSourcesList_InvalidEntry_ReturnsLineNumber(t *testing.T) {
+	for i, test := range sourcesListErrorTests {
+		_, err := ParseSourcesList(bytes.NewBufferString(test.input))
+		listErr, ok := err.(*SourcesListError)
+		if !ok {
+			t.Fatalf("test(%v): expected *SourcesListError, got: %v", i, err)
+		}
+		if expected, actual := test.line, listErr.Line; expected != actual {
+			t.Fatalf("test(%v): line: expected=%v actual=%v", i, expected, actual)
+		}
+	}
+}
@@ -4,13 +4,11 @@ import (
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
-	"os"
 	"path"
 	"reflect"
+	"sync"
 	"testing"
 
-	"bytes"
-
 	"golang.org/x/crypto/openpgp"
 )
 
@@ -55,12 +53,17 @@ func TestTestRepository_BlockFile(t *testing.T) {
 type testRepository struct {
 	*httptest.Server
 	blockFilename string
+	mu            sync.Mutex
+	requests      []string
 }
 
 func NewTestRepository() *testRepository {
 	tr := &testRepository{}
 	mux := http.NewServeMux()
 	mux.Handle("/ubuntu/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tr.mu.Lock()
+		tr.requests = append(tr.requests, r.URL.Path)
+		tr.mu.Unlock()
 		if path.Base(r.URL.Path) == tr.blockFilename {
 			w.WriteHeader(http.StatusNotFound)
 			return
@@ -75,29 +78,19 @@ func (tr *testRepository) BlockFile(filename string) {
 	tr.blockFilename = filename
 }
 
+// Requests returns the paths requested from the server.
+func (tr *testRepository) Requests() []string {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	return append([]string(nil), tr.requests...)
+}
+
 func (tr *testRepository) KeyRing() openpgp.EntityList {
-	path := "testdata/ubuntu-keyring_2012.05.19/keyrings"
-	files, err := ioutil.ReadDir(path)
-	if err != nil {
-		panic(err)
-	}
-	buf := &bytes.Buffer{}
-	for _, file := range files {
-		f, err := os.Open(path + "/" + file.Name())
-		if err != nil {
-			panic(err)
-		}
-		defer f.Close()
-		_, err = buf.ReadFrom(f)
-		if err != nil {
-			panic(err)
-		}
-	}
-	el, err := openpgp.ReadKeyRing(buf)
+	keyring, err := KeyRingFromDir("testdata/ubuntu-keyring_2012.05.19/keyrings")
 	if err != nil {
 		panic(err)
 	}
-	return el
+	return keyring.Entities
 }
 
 func (tr *testRepository) Repository() *Repository {
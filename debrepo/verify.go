@@ -0,0 +1,289 @@
+package debrepo
+
+import (
+	"bytes"
+	"crypto"
+	"hash"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/openpgp"
+	pgperrors "golang.org/x/crypto/openpgp/errors"
+	"golang.org/x/crypto/openpgp/packet"
+)
+
+const (
+	// ErrSignatureHashRejected is set on a SignatureResult when the
+	// signature's hash algorithm is rejected by the SignaturePolicy.
+	ErrSignatureHashRejected = Error("signature hash algorithm rejected by policy")
+
+	// ErrSigningKeyExpired is set on a SignatureResult when the signing key
+	// has expired, or had expired when the signature was made.
+	ErrSigningKeyExpired = Error("signature made by expired key")
+
+	// ErrUntrustedSigner is set on a SignatureResult when the signing key is
+	// not one of the signers listed in the SignaturePolicy.
+	ErrUntrustedSigner = Error("signer not trusted by policy")
+)
+
+// SignaturePolicy controls which signatures on a Release file are accepted.
+//
+// Signatures using a hash algorithm listed in RejectHashes, such as
+// crypto.SHA1, are treated as invalid.
+//
+// If Signers is not empty, only signatures made by keys whose primary key
+// fingerprint is listed are trusted. Other signatures are treated as invalid.
+//
+// Threshold is the minimum number of distinct trusted signers required. If it
+// is greater than one and not met, a *SignatureThresholdError listing the
+// failed signatures is returned. Otherwise at least one valid signature is
+// required.
+//
+// Signatures made by keys which have expired as of Now are treated as invalid,
+// as gpgv does. If Now is nil, time.Now is used.
+type SignaturePolicy struct {
+	RejectHashes []crypto.Hash
+	Signers      [][20]byte
+	Threshold    int
+	Now          func() time.Time
+}
+
+func (p SignaturePolicy) now() time.Time {
+	if p.Now != nil {
+		return p.Now()
+	}
+	return time.Now()
+}
+
+func (p SignaturePolicy) trusts(fingerprint [20]byte) bool {
+	if len(p.Signers) == 0 {
+		return true
+	}
+	for _, signer := range p.Signers {
+		if signer == fingerprint {
+			return true
+		}
+	}
+	return false
+}
+
+func (p SignaturePolicy) rejectsHash(h crypto.Hash) bool {
+	for _, rejected := range p.RejectHashes {
+		if h == rejected {
+			return true
+		}
+	}
+	return false
+}
+
+// SignatureResult is the outcome of verifying one signature on a Release
+// file. Err is nil if the signature is valid. Fingerprint, UserIDs, KeyExpiry
+// and Signer describe the signing key and are only set if the key was found
+// in the keyring. KeyExpiry is zero if the key does not expire.
+type SignatureResult struct {
+	KeyID        uint64
+	Fingerprint  [20]byte
+	UserIDs      []string
+	CreationTime time.Time
+	Hash         crypto.Hash
+	PubKeyAlgo   packet.PublicKeyAlgorithm
+	KeyExpiry    time.Time
+	Signer       *openpgp.Entity
+	Err          error
+}
+
+// VerificationResult holds the outcome of verifying every signature on a
+// Release file.
+type VerificationResult struct {
+	Signatures []SignatureResult
+}
+
+// Valid returns the valid signatures.
+func (v *VerificationResult) Valid() []SignatureResult {
+	var valid []SignatureResult
+	for _, s := range v.Signatures {
+		if s.Err == nil {
+			valid = append(valid, s)
+		}
+	}
+	return valid
+}
+
+// Failed returns the signatures which could not be verified.
+func (v *VerificationResult) Failed() []SignatureResult {
+	var failed []SignatureResult
+	for _, s := range v.Signatures {
+		if s.Err != nil {
+			failed = append(failed, s)
+		}
+	}
+	return failed
+}
+
+// Verify checks every signature on the Release file against keyring and
+// policy. An error is returned if the signature cannot be parsed or the
+// policy is not met. If no signature is valid and the policy's Threshold is
+// at most one, the error of the first signature is returned, such as
+// ErrUnknownIssuer (golang.org/x/crypto/openpgp/errors) if the signer isn't
+// known. The VerificationResult is returned whenever the signatures could be
+// parsed.
+func (r *Release) Verify(keyring openpgp.KeyRing, policy SignaturePolicy) (*VerificationResult, error) {
+	if r.ArmoredSignature == nil {
+		return nil, errors.New("release file is not signed")
+	}
+	signed := r.Bytes
+	if len(signed) == 0 {
+		signed = r.Plaintext
+	}
+	return verifySignatures(keyring, signed, r.ArmoredSignature.Body, policy)
+}
+
+// verifySignatures verifies each signature packet read from signature over
+// signed.
+func verifySignatures(keyring openpgp.KeyRing, signed []byte, signature io.Reader, policy SignaturePolicy) (*VerificationResult, error) {
+	result := &VerificationResult{}
+	packets := packet.NewReader(signature)
+	for {
+		p, err := packets.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch sig := p.(type) {
+		case *packet.Signature:
+			if sig.IssuerKeyId == nil {
+				return nil, pgperrors.StructuralError("signature doesn't have an issuer")
+			}
+			s := SignatureResult{
+				KeyID:        *sig.IssuerKeyId,
+				CreationTime: sig.CreationTime,
+				Hash:         sig.Hash,
+				PubKeyAlgo:   sig.PubKeyAlgo,
+			}
+			s.verify(keyring, signed, sig.SigType, policy, func(key openpgp.Key, h hash.Hash) error {
+				return key.PublicKey.VerifySignature(h, sig)
+			})
+			result.Signatures = append(result.Signatures, s)
+		case *packet.SignatureV3:
+			s := SignatureResult{
+				KeyID:        sig.IssuerKeyId,
+				CreationTime: sig.CreationTime,
+				Hash:         sig.Hash,
+				PubKeyAlgo:   sig.PubKeyAlgo,
+			}
+			s.verify(keyring, signed, sig.SigType, policy, func(key openpgp.Key, h hash.Hash) error {
+				return key.PublicKey.VerifySignatureV3(h, sig)
+			})
+			result.Signatures = append(result.Signatures, s)
+		default:
+			return nil, pgperrors.StructuralError("non signature packet found")
+		}
+	}
+	if len(result.Signatures) == 0 {
+		return nil, errors.New("no signatures found")
+	}
+	if policy.Threshold > 1 {
+		if signers := result.signers(); signers < policy.Threshold {
+			return result, &SignatureThresholdError{
+				Required: policy.Threshold,
+				Valid:    signers,
+				Failed:   result.Failed(),
+			}
+		}
+		return result, nil
+	}
+	if len(result.Valid()) == 0 {
+		return result, result.Signatures[0].Err
+	}
+	return result, nil
+}
+
+// signers returns the number of distinct keys which made valid signatures.
+func (v *VerificationResult) signers() int {
+	seen := make(map[[20]byte]bool)
+	for _, s := range v.Valid() {
+		seen[s.Fingerprint] = true
+	}
+	return len(seen)
+}
+
+// verify sets s.Err to the result of checking the signature against the keys
+// in keyring matching s.KeyID. If a key is found its details are recorded in
+// s.
+func (s *SignatureResult) verify(keyring openpgp.KeyRing, signed []byte, sigType packet.SignatureType,
+	policy SignaturePolicy, check func(openpgp.Key, hash.Hash) error) {
+	if policy.rejectsHash(s.Hash) {
+		s.Err = errors.Wrap(ErrSignatureHashRejected, hashAlgorithmName(s.Hash))
+		return
+	}
+	if !s.Hash.Available() {
+		s.Err = pgperrors.UnsupportedError("hash not available: " + hashAlgorithmName(s.Hash))
+		return
+	}
+	keys := keyring.KeysByIdUsage(s.KeyID, packet.KeyFlagSign)
+	if len(keys) == 0 {
+		s.Err = pgperrors.ErrUnknownIssuer
+		return
+	}
+	for _, key := range keys {
+		h := s.Hash.New()
+		var w io.Writer = h
+		switch sigType {
+		case packet.SigTypeBinary:
+		case packet.SigTypeText:
+			w = openpgp.NewCanonicalTextHash(h)
+		default:
+			s.Err = pgperrors.UnsupportedError("unsupported signature type")
+			return
+		}
+		if _, err := io.Copy(w, bytes.NewReader(signed)); err != nil {
+			s.Err = err
+			return
+		}
+		if s.Err = check(key, h); s.Err != nil {
+			continue
+		}
+		s.Signer = key.Entity
+		s.Fingerprint = key.Entity.PrimaryKey.Fingerprint
+		for id := range key.Entity.Identities {
+			s.UserIDs = append(s.UserIDs, id)
+		}
+		sort.Strings(s.UserIDs)
+		if !policy.trusts(s.Fingerprint) {
+			s.Err = ErrUntrustedSigner
+			return
+		}
+		if expiry, ok := entityExpiry(key.Entity); ok {
+			s.KeyExpiry = expiry
+			if s.CreationTime.After(expiry) || policy.now().After(expiry) {
+				s.Err = ErrSigningKeyExpired
+			}
+		}
+		return
+	}
+}
+
+// hashAlgorithmName returns the OpenPGP name of h.
+func hashAlgorithmName(h crypto.Hash) string {
+	switch h {
+	case crypto.MD5:
+		return "MD5"
+	case crypto.SHA1:
+		return "SHA1"
+	case crypto.RIPEMD160:
+		return "RIPEMD160"
+	case crypto.SHA224:
+		return "SHA224"
+	case crypto.SHA256:
+		return "SHA256"
+	case crypto.SHA384:
+		return "SHA384"
+	case crypto.SHA512:
+		return "SHA512"
+	}
+	return "unknown"
+}
@@ -0,0 +1,224 @@
+package debrepo
+
+import (
+	"bytes"
+	"crypto"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/armor"
+	pgperrors "golang.org/x/crypto/openpgp/errors"
+	"golang.org/x/crypto/openpgp/packet"
+	"golang.org/x/net/context"
+)
+
+func TestReleaseVerify_TestRepository_ReturnsAllSignatures(t *testing.T) {
+	tr := NewTestRepository()
+	defer tr.Close()
+	release, err := GetRelease(context.Background(), nil, tr.Repository())
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := release.Verify(tr.KeyRing(), SignaturePolicy{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := []SignatureResult{
+		{
+			KeyID:       0x40976EAF437D05B5,
+			Fingerprint: testFingerprint("630239CC130E1A7FD81A27B140976EAF437D05B5"),
+			UserIDs:     []string{"Ubuntu Archive Automatic Signing Key <ftpmaster@ubuntu.com>"},
+			Hash:        crypto.SHA512,
+			PubKeyAlgo:  packet.PubKeyAlgoDSA,
+		},
+		{
+			KeyID:       0x3B4FE6ACC0B21F32,
+			Fingerprint: testFingerprint("790BC7277767219C42C86F933B4FE6ACC0B21F32"),
+			UserIDs:     []string{"Ubuntu Archive Automatic Signing Key (2012) <ftpmaster@ubuntu.com>"},
+			Hash:        crypto.SHA512,
+			PubKeyAlgo:  packet.PubKeyAlgoRSA,
+		},
+	}
+	if expected, actual := len(expected), len(result.Signatures); expected != actual {
+		t.Fatalf("expected=%v actual=%v", expected, actual)
+	}
+	for i, expected := range expected {
+		actual := result.Signatures[i]
+		if actual.Err != nil {
+			t.Fatalf("test(%v): unexpected error: %v", i, actual.Err)
+		}
+		if expected.KeyID != actual.KeyID || expected.Fingerprint != actual.Fingerprint ||
+			expected.Hash != actual.Hash || expected.PubKeyAlgo != actual.PubKeyAlgo ||
+			len(actual.UserIDs) != 1 || expected.UserIDs[0] != actual.UserIDs[0] {
+			t.Fatalf("test(%v): expected=%+v actual=%+v", i, expected, actual)
+		}
+		if actual.CreationTime.IsZero() || actual.Signer == nil {
+			t.Fatalf("test(%v): expected creation time and signer: %+v", i, actual)
+		}
+	}
+}
+
+func TestReleaseVerify_FailedSignatures_ReturnsErrors(t *testing.T) {
+	tests := []struct {
+		keyring openpgp.KeyRing
+		policy  SignaturePolicy
+		err     error
+	}{
+		{openpgp.EntityList{}, SignaturePolicy{}, pgperrors.ErrUnknownIssuer},
+		{nil, SignaturePolicy{RejectHashes: []crypto.Hash{crypto.SHA1, crypto.SHA512}}, ErrSignatureHashRejected},
+	}
+	for i, test := range tests {
+		tr := NewTestRepository()
+		release, err := GetRelease(context.Background(), nil, tr.Repository())
+		if err != nil {
+			t.Fatal(err)
+		}
+		keyring := test.keyring
+		if keyring == nil {
+			keyring = tr.KeyRing()
+		}
+		tr.Close()
+		result, err := release.Verify(keyring, test.policy)
+		if expected, actual := test.err, errors.Cause(err); expected != actual {
+			t.Fatalf("test(%v): expected=%v actual=%v", i, expected, err)
+		}
+		if expected, actual := 2, len(result.Failed()); expected != actual {
+			t.Fatalf("test(%v): expected=%v actual=%v", i, expected, actual)
+		}
+	}
+}
+
+func TestClientGetVerifiedReleaseIndex_SHA1Signature_RejectedByPolicy(t *testing.T) {
+	el := testGenerateEntityList()
+	release := []byte("Origin: Test\n")
+	signature := &bytes.Buffer{}
+	config := &packet.Config{DefaultHash: crypto.SHA1}
+	if err := openpgp.ArmoredDetachSign(signature, el[0], bytes.NewReader(release), config); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		policy SignaturePolicy
+		err    error
+	}{
+		{SignaturePolicy{}, nil},
+		{SignaturePolicy{RejectHashes: []crypto.Hash{crypto.SHA1}}, ErrSignatureHashRejected},
+	}
+	for i, test := range tests {
+		client := &Client{KeyRing: &testKeyRing{el}, Architecture: "amd64", SignaturePolicy: test.policy}
+		client.testhookGetFile = func(ctx context.Context, url string) ([]byte, error) {
+			switch path.Base(url) {
+			case "Release":
+				return release, nil
+			case "Release.gpg":
+				return signature.Bytes(), nil
+			}
+			return nil, errors.Errorf("not found: %s", url)
+		}
+		repo, _ := ParseRepository("deb http://example.com/ubuntu xenial main")
+		_, result, err := client.GetVerifiedReleaseIndex(context.Background(), repo)
+		if expected, actual := test.err, errors.Cause(err); expected != actual {
+			t.Fatalf("test(%v): expected=%v actual=%v", i, expected, err)
+		}
+		if err == nil && result.Signatures[0].Hash != crypto.SHA1 {
+			t.Fatalf("test(%v): expected=%v actual=%v", i, crypto.SHA1, result.Signatures[0].Hash)
+		}
+	}
+}
+
+func testFingerprint(s string) [20]byte {
+	var fp [20]byte
+	copy(fp[:], decodeHexString(s))
+	return fp
+}
+
+func TestReleaseVerify_Threshold_RequiresDistinctTrustedSigners(t *testing.T) {
+	archive2004 := testFingerprint("630239CC130E1A7FD81A27B140976EAF437D05B5")
+	archive2012 := testFingerprint("790BC7277767219C42C86F933B4FE6ACC0B21F32")
+	cdimage := testFingerprint("C5986B4F1257FFA86632CBA746181433FBB75451")
+	tests := []struct {
+		policy SignaturePolicy
+		valid  int
+		failed int
+	}{
+		{SignaturePolicy{Threshold: 2}, 2, 0},
+		{SignaturePolicy{Threshold: 2, Signers: [][20]byte{archive2004, archive2012}}, 2, 0},
+		{SignaturePolicy{Threshold: 2, Signers: [][20]byte{archive2012, cdimage}}, 1, 1},
+		{SignaturePolicy{Threshold: 3}, 2, 0},
+		{SignaturePolicy{Threshold: 2, RejectHashes: []crypto.Hash{crypto.SHA512}}, 0, 2},
+	}
+	for i, test := range tests {
+		tr := NewTestRepository()
+		release, err := GetRelease(context.Background(), nil, tr.Repository())
+		if err != nil {
+			t.Fatal(err)
+		}
+		keyring := tr.KeyRing()
+		tr.Close()
+		_, err = release.Verify(keyring, test.policy)
+		if test.valid >= test.policy.Threshold {
+			if err != nil {
+				t.Fatalf("test(%v): unexpected error: %v", i, err)
+			}
+			continue
+		}
+		thresholdErr, ok := err.(*SignatureThresholdError)
+		if !ok {
+			t.Fatalf("test(%v): expected *SignatureThresholdError, got: %v", i, err)
+		}
+		if expected, actual := test.valid, thresholdErr.Valid; expected != actual {
+			t.Fatalf("test(%v): expected=%v actual=%v", i, expected, actual)
+		}
+		if expected, actual := test.failed, len(thresholdErr.Failed); expected != actual {
+			t.Fatalf("test(%v): expected=%v actual=%v", i, expected, actual)
+		}
+	}
+}
+
+func TestClientGetVerifiedReleaseIndex_SignedByOneOfTwoRequired_ReturnsError(t *testing.T) {
+	inRelease, _, _, keyRing := newTestKeyRingAndRelease()
+	client := &Client{
+		KeyRing:         keyRing,
+		Architecture:    "amd64",
+		SignaturePolicy: SignaturePolicy{Threshold: 2},
+	}
+	client.testhookGetFile = func(ctx context.Context, url string) ([]byte, error) {
+		if path.Base(url) == "InRelease" {
+			return inRelease, nil
+		}
+		return nil, errors.Errorf("not found: %s", url)
+	}
+	repo, _ := ParseRepository("deb http://example.com/ubuntu xenial main")
+	if _, _, err := client.GetVerifiedReleaseIndex(context.Background(), repo); err == nil {
+		t.Fatal("expected error when threshold not met")
+	}
+}
+
+func TestReleaseVerify_KeyExpiredAfterSigning_ReturnsErrSigningKeyExpired(t *testing.T) {
+	_, release, releaseGPG, keyRing := newTestKeyRingAndRelease()
+	entity := keyRing.(*testKeyRing).el[0]
+	lifetime := uint32(time.Hour / time.Second)
+	for _, id := range entity.Identities {
+		id.SelfSignature.KeyLifetimeSecs = &lifetime
+	}
+	verify := func(policy SignaturePolicy) (*VerificationResult, error) {
+		signature, err := armor.Decode(bytes.NewReader(releaseGPG))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return (&Release{Plaintext: release, ArmoredSignature: signature}).Verify(keyRing.KeyRing(), policy)
+	}
+	if _, err := verify(SignaturePolicy{}); err != nil {
+		t.Fatalf("unexpected error before key expiry: %v", err)
+	}
+	later := func() time.Time { return time.Now().Add(2 * time.Hour) }
+	result, err := verify(SignaturePolicy{Now: later})
+	if expected, actual := ErrSigningKeyExpired, err; expected != actual {
+		t.Fatalf("expected=%v actual=%v", expected, actual)
+	}
+	if result.Signatures[0].KeyExpiry.IsZero() {
+		t.Fatal("expected key expiry to be set")
+	}
+}
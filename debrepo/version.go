@@ -0,0 +1,207 @@
+package debrepo
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Version is a Debian package version in the form
+// [epoch:]upstream_version[-debian_revision].
+// See https://www.debian.org/doc/debian-policy/ch-controlfields.html#version
+type Version struct {
+	Epoch    int
+	Upstream string
+	Revision string
+}
+
+// ParseVersion parses s into a Version. It returns an error for the cases that
+// dpkg treats as fatal: an empty version, embedded spaces, an invalid epoch or
+// an empty upstream version or revision.
+func ParseVersion(s string) (Version, error) {
+	var v Version
+	s = strings.TrimSpace(s)
+	if len(s) == 0 {
+		return v, errors.New("version string is empty")
+	}
+	if strings.ContainsAny(s, " \t") {
+		return v, errors.Errorf("version string has embedded spaces: %s", s)
+	}
+	if i := strings.IndexByte(s, ':'); i >= 0 {
+		if i == 0 {
+			return v, errors.Errorf("epoch in version is empty: %s", s)
+		}
+		epoch, err := strconv.Atoi(s[:i])
+		if err != nil {
+			return v, errors.Errorf("epoch in version is not a number: %s", s)
+		}
+		if epoch < 0 {
+			return v, errors.Errorf("epoch in version is negative: %s", s)
+		}
+		v.Epoch = epoch
+		s = s[i+1:]
+		if len(s) == 0 {
+			return v, errors.Errorf("nothing after colon in version number")
+		}
+	}
+	if i := strings.LastIndexByte(s, '-'); i >= 0 {
+		v.Revision = s[i+1:]
+		if len(v.Revision) == 0 {
+			return v, errors.Errorf("revision number is empty")
+		}
+		s = s[:i]
+	}
+	if len(s) == 0 {
+		return v, errors.New("version number is empty")
+	}
+	v.Upstream = s
+	return v, nil
+}
+
+// MustParseVersion is like ParseVersion but panics if s cannot be parsed.
+func MustParseVersion(s string) Version {
+	v, err := ParseVersion(s)
+	if err != nil {
+		panic(err)
+	}
+	return v
+}
+
+// String returns the version in the form used in control files. The epoch is
+// omitted when it is zero.
+func (v Version) String() string {
+	s := v.Upstream
+	if v.Epoch != 0 {
+		s = strconv.Itoa(v.Epoch) + ":" + s
+	}
+	if len(v.Revision) != 0 {
+		s += "-" + v.Revision
+	}
+	return s
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (v Version) MarshalText() ([]byte, error) {
+	return []byte(v.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler. See ParseVersion.
+func (v *Version) UnmarshalText(text []byte) error {
+	parsed, err := ParseVersion(string(text))
+	if err != nil {
+		return err
+	}
+	*v = parsed
+	return nil
+}
+
+// Compare returns -1, 0 or 1 if v is less than, equal to or greater than o.
+// The comparison follows the algorithm used by dpkg: epochs are compared
+// numerically, then the upstream versions and finally the revisions are
+// compared with verrevcmp.
+func (v Version) Compare(o Version) int {
+	if v.Epoch != o.Epoch {
+		if v.Epoch < o.Epoch {
+			return -1
+		}
+		return 1
+	}
+	if c := verrevcmp(v.Upstream, o.Upstream); c != 0 {
+		return c
+	}
+	return verrevcmp(v.Revision, o.Revision)
+}
+
+// CompareVersions parses and compares two version strings. See
+// Version.Compare.
+func CompareVersions(a, b string) (int, error) {
+	va, err := ParseVersion(a)
+	if err != nil {
+		return 0, err
+	}
+	vb, err := ParseVersion(b)
+	if err != nil {
+		return 0, err
+	}
+	return va.Compare(vb), nil
+}
+
+// verrevcmp compares upstream versions or revisions. Strings are compared in
+// alternating non-digit and digit parts. Non-digit parts are compared
+// character by character with letters sorting before non-letters and '~'
+// sorting before everything, even the end of the part. Digit parts are
+// compared numerically.
+func verrevcmp(a, b string) int {
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		firstDiff := 0
+		for (i < len(a) && !isDigit(a[i])) || (j < len(b) && !isDigit(b[j])) {
+			ac, bc := verOrder(a, i), verOrder(b, j)
+			if ac != bc {
+				return sign(ac - bc)
+			}
+			i++
+			j++
+		}
+		for i < len(a) && a[i] == '0' {
+			i++
+		}
+		for j < len(b) && b[j] == '0' {
+			j++
+		}
+		for i < len(a) && isDigit(a[i]) && j < len(b) && isDigit(b[j]) {
+			if firstDiff == 0 {
+				firstDiff = int(a[i]) - int(b[j])
+			}
+			i++
+			j++
+		}
+		if i < len(a) && isDigit(a[i]) {
+			return 1
+		}
+		if j < len(b) && isDigit(b[j]) {
+			return -1
+		}
+		if firstDiff != 0 {
+			return sign(firstDiff)
+		}
+	}
+	return 0
+}
+
+// verOrder returns the sort weight of the character at s[i]. Positions past
+// the end of s and digits weigh 0.
+func verOrder(s string, i int) int {
+	if i >= len(s) {
+		return 0
+	}
+	c := s[i]
+	switch {
+	case isDigit(c):
+		return 0
+	case isAlpha(c):
+		return int(c)
+	case c == '~':
+		return -1
+	}
+	return int(c) + 256
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isAlpha(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func sign(n int) int {
+	switch {
+	case n < 0:
+		return -1
+	case n > 0:
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,151 @@
+package debrepo
+
+import (
+	"reflect"
+	"testing"
+)
+
+var parseVersionTests = []struct {
+	input    string
+	expected Version
+	valid    bool
+}{
+	{"1.0", Version{Upstream: "1.0"}, true},
+	{"1.0-1", Version{Upstream: "1.0", Revision: "1"}, true},
+	{"1:1.0-1", Version{Epoch: 1, Upstream: "1.0", Revision: "1"}, true},
+	{"0:1.0", Version{Upstream: "1.0"}, true},
+	{"1.2-3-4ubuntu1", Version{Upstream: "1.2-3", Revision: "4ubuntu1"}, true},
+	{"2:1.0:2-3", Version{Epoch: 2, Upstream: "1.0:2", Revision: "3"}, true},
+	{" 1.0 ", Version{Upstream: "1.0"}, true},
+	{"", Version{}, false},
+	{"1.0 1", Version{}, false},
+	{":1.0", Version{}, false},
+	{"a:1.0", Version{}, false},
+	{"-1:1.0", Version{}, false},
+	{"1:", Version{}, false},
+	{"1.0-", Version{}, false},
+	{"-1", Version{}, false},
+}
+
+func TestParseVersion(t *testing.T) {
+	for i, test := range parseVersionTests {
+		actual, err := ParseVersion(test.input)
+		if expected, actual := test.valid, err == nil; expected != actual {
+			t.Fatalf("test(%v): valid: expected=%v actual=%v: %v", i, expected, actual, err)
+		}
+		if !test.valid {
+			continue
+		}
+		if !reflect.DeepEqual(test.expected, actual) {
+			t.Fatalf("test(%v): expected=%+v actual=%+v", i, test.expected, actual)
+		}
+	}
+}
+
+func TestVersion_String(t *testing.T) {
+	for _, s := range []string{"1.0", "1.0-1", "1:1.0-1", "1.2-3-4"} {
+		if actual := MustParseVersion(s).String(); s != actual {
+			t.Fatalf("expected=%v actual=%v", s, actual)
+		}
+	}
+	if expected, actual := "1.0", MustParseVersion("0:1.0").String(); expected != actual {
+		t.Fatalf("expected=%v actual=%v", expected, actual)
+	}
+}
+
+// compareVersionTests were checked against dpkg --compare-versions.
+var compareVersionTests = []struct {
+	a, b     string
+	expected int
+}{
+	{"1.0", "1.0", 0},
+	{"1.0", "1.1", -1},
+	{"1.1", "1.0", 1},
+	{"1.0", "1.0-0", 0},
+	{"1.0-0", "1.0", 0},
+	{"1.0", "1.0-1", -1},
+	{"1.0-1", "1.0-2", -1},
+	{"1.0-2", "1.0-10", -1},
+	{"1.0-10", "1.0-2", 1},
+	{"1.0~rc1", "1.0", -1},
+	{"1.0~rc1", "1.0~rc2", -1},
+	{"1.0~~", "1.0~", -1},
+	{"1.0~", "1.0", -1},
+	{"1.0~~a", "1.0~~", 1},
+	{"1.0", "1.0a", -1},
+	{"1.0a", "1.0b", -1},
+	{"1.0a", "1.0+", -1},
+	{"1.0+", "1.0.", -1},
+	{"1.0+dfsg", "1.0", 1},
+	{"1.0+dfsg-1", "1.0-1", 1},
+	{"1:0.1", "2.0", 1},
+	{"0:1.0", "1.0", 0},
+	{"1:1.0", "0:2.0", 1},
+	{"2:1.0", "10:0.1", -1},
+	{"10:0.1", "2:1.0", 1},
+	{"1.01", "1.1", 0},
+	{"1.001", "1.1", 0},
+	{"1.10", "1.9", 1},
+	{"1.9", "1.10", -1},
+	{"0001", "1", 0},
+	{"1.0.0", "1.0", 1},
+	{"1.0", "1.0.0", -1},
+	{"a", "1", 1},
+	{"1", "a", -1},
+	{"a", "b", -1},
+	{"A", "a", -1},
+	{"Z", "a", -1},
+	{"~", "~~", 1},
+	{"~~", "~", -1},
+	{"~a", "~", 1},
+	{"+", ".", -1},
+	{".", "+", 1},
+	{"1.2.3", "1.2.3~", 1},
+	{"1.2.3~beta", "1.2.3~alpha", 1},
+	{"1.2.3+b1", "1.2.3", 1},
+	{"2.4.7-1ubuntu1", "2.4.7-1", 1},
+	{"2.4.7-1ubuntu1", "2.4.7-1build1", 1},
+	{"0.1.10-0ubuntu3", "0.1.10-0ubuntu3", 0},
+	{"0.1.10-0ubuntu3", "0.1.10-0ubuntu10", -1},
+	{"2.23-0ubuntu3", "2.23-0ubuntu10", -1},
+	{"1.2-3-4", "1.2-3", 1},
+	{"1.2-3-4", "1.2-3-5", -1},
+	{"7.0", "7", 1},
+	{"7", "7.0", -1},
+	{"1a", "1", 1},
+	{"1", "1a", -1},
+	{"1~", "1", -1},
+	{"1~", "1a", -1},
+	{"20160101", "2016.01.01", 1},
+	{"9.10", "9.1a", 1},
+	{"1:1.2.3-1", "1:1.2.3-1", 0},
+	{"1.0-1~bpo8+1", "1.0-1", -1},
+	{"1.0-1", "1.0-1+deb8u1", -1},
+	{"1.0-1+deb8u1", "1.0-1+deb8u2", -1},
+	{"3.14.15~git20160101", "3.14.15", -1},
+	{"4.4.0-21.37", "4.4.0-21.37~14.04.1", 1},
+	{"1.18.4ubuntu1", "1.18.4", 1},
+	{"1.18.4ubuntu1.1", "1.18.4ubuntu1", 1},
+	{"1.0a~", "1.0a", -1},
+	{"1.0-a", "1.0-A", 1},
+	{"1.0-0.1", "1.0-0", 1},
+	{"1.0", "1.0-0~", 1},
+	{"0", "00", 0},
+	{"1:1", "1:01", 0},
+	{"1.0-1a", "1.0-1.", -1},
+}
+
+func TestVersion_Compare(t *testing.T) {
+	for i, test := range compareVersionTests {
+		actual, err := CompareVersions(test.a, test.b)
+		if err != nil {
+			t.Fatalf("test(%v): unexpected error: %v", i, err)
+		}
+		if expected := test.expected; expected != actual {
+			t.Fatalf("test(%v): compare(%s, %s): expected=%v actual=%v", i, test.a, test.b, expected, actual)
+		}
+		if expected, actual := -test.expected, MustParseVersion(test.b).Compare(MustParseVersion(test.a)); expected != actual {
+			t.Fatalf("test(%v): compare(%s, %s): expected=%v actual=%v", i, test.b, test.a, expected, actual)
+		}
+	}
+}